@@ -0,0 +1,97 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+)
+
+var engineListOpts struct {
+	Order []string
+	Start int32
+	Limit int32
+}
+
+// engineListCmd represents the engine list command
+var engineListCmd = &cobra.Command{
+	Use:   "list [filter...]",
+	Short: "Lists engines known to the Bhojpur Session server",
+	Long: `Lists engines known to the Bhojpur Session server.
+
+Each argument is a filter expression. All expressions must match, whereas
+any of the comma separated terms within an expression may match:
+
+  field==value   field equals value
+  field!=value   field does not equal value
+  field~=value   field contains value
+  field|=value   field starts with value
+  field=|value   field ends with value
+  field          field exists (prefix with ! for does not exist)
+
+Supported fields are name, phase, owner, spec, success, created and
+annotation.<key>.`,
+	Example: `  sessionctl engine list phase==running,phase==waiting
+  sessionctl engine list spec==default --order created:asc`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter, err := parseFilter(args)
+		if err != nil {
+			return err
+		}
+		order, err := parseOrder(engineListOpts.Order)
+		if err != nil {
+			return err
+		}
+
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewSessionServiceClient(conn)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		resp, err := client.ListEngines(ctx, &v1.ListEnginesRequest{
+			Filter: filter,
+			Order:  order,
+			Start:  engineListOpts.Start,
+			Limit:  engineListOpts.Limit,
+		})
+		if err != nil {
+			return err
+		}
+		if engineCmdOpts.Output != "table" {
+			return printProto(os.Stdout, engineCmdOpts.Output, resp)
+		}
+		return printEngines(os.Stdout, resp.Result...)
+	},
+}
+
+func init() {
+	engineCmd.AddCommand(engineListCmd)
+
+	engineListCmd.Flags().StringSliceVar(&engineListOpts.Order, "order", nil, "order the result, e.g. created:desc or name:asc")
+	engineListCmd.Flags().Int32Var(&engineListOpts.Start, "start", 0, "skip the first n engines")
+	engineListCmd.Flags().Int32Var(&engineListOpts.Limit, "limit", 50, "list at most n engines (0 for no limit)")
+}
@@ -0,0 +1,131 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	"github.com/bhojpur/session/pkg/server"
+)
+
+var engineListenOpts struct {
+	Logs    string
+	Updates bool
+}
+
+// engineListenCmd represents the engine listen command
+var engineListenCmd = &cobra.Command{
+	Use:   "listen <name>",
+	Short: "Streams the log output and status updates of an engine",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		logs, err := parseListenLogs(engineListenOpts.Logs)
+		if err != nil {
+			return err
+		}
+
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewSessionServiceClient(conn)
+
+		return listen(context.Background(), client, args[0], logs, engineListenOpts.Updates)
+	},
+}
+
+func init() {
+	engineCmd.AddCommand(engineListenCmd)
+
+	engineListenCmd.Flags().StringVar(&engineListenOpts.Logs, "logs", "raw", "log mode: raw, unsliced, html or disabled")
+	engineListenCmd.Flags().BoolVar(&engineListenOpts.Updates, "updates", true, "print engine status updates")
+}
+
+func parseListenLogs(mode string) (v1.ListenRequestLogs, error) {
+	res, ok := v1.ListenRequestLogs_value["LOGS_"+strings.ToUpper(mode)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log mode %q", mode)
+	}
+	return v1.ListenRequestLogs(res), nil
+}
+
+// listen streams the events of an engine to stdout until the engine is done
+// or the server closes the stream.
+func listen(ctx context.Context, client v1.SessionServiceClient, name string, logs v1.ListenRequestLogs, updates bool) error {
+	stream, err := client.Listen(ctx, &v1.ListenRequest{
+		Name:    name,
+		Logs:    logs,
+		Updates: updates,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if update := msg.GetUpdate(); update != nil {
+			printUpdate(os.Stdout, update)
+		}
+		if slice := msg.GetSlice(); slice != nil {
+			printSlice(os.Stdout, logs, slice)
+		}
+	}
+}
+
+func printUpdate(out io.Writer, update *v1.EngineStatus) {
+	line := fmt.Sprintf("[%s] phase %s", update.Name, server.PhaseName(update.Phase))
+	if update.Details != "" {
+		line += ": " + update.Details
+	}
+	fmt.Fprintln(out, line)
+}
+
+func printSlice(out io.Writer, logs v1.ListenRequestLogs, slice *v1.LogSliceEvent) {
+	if logs != v1.ListenRequestLogs_LOGS_RAW {
+		fmt.Fprintln(out, slice.Payload)
+		return
+	}
+
+	switch slice.Type {
+	case v1.LogSliceType_SLICE_START:
+		fmt.Fprintf(out, "[%s] started\n", slice.Name)
+	case v1.LogSliceType_SLICE_DONE:
+		fmt.Fprintf(out, "[%s] done\n", slice.Name)
+	case v1.LogSliceType_SLICE_FAIL:
+		fmt.Fprintf(out, "[%s] failed: %s\n", slice.Name, slice.Payload)
+	case v1.LogSliceType_SLICE_ABANDONED:
+		fmt.Fprintf(out, "[%s] abandoned\n", slice.Name)
+	default:
+		fmt.Fprintf(out, "[%s] %s\n", slice.Name, slice.Payload)
+	}
+}
@@ -0,0 +1,139 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+)
+
+var engineStartOpts struct {
+	Owner       string
+	NameSuffix  string
+	Annotations map[string]string
+	WaitUntil   string
+	Replay      string
+	Follow      bool
+}
+
+// engineStartCmd represents the engine start command
+var engineStartCmd = &cobra.Command{
+	Use:   "start <engine.yaml>",
+	Short: "Starts a new engine from an engine spec (use - to read it from stdin)",
+	Example: `  sessionctl engine start redis.yaml --annotation team=checkout --follow
+  sessionctl engine start --replay redis.3`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if (engineStartOpts.Replay == "") == (len(args) == 0) {
+			return fmt.Errorf("either an engine spec or --replay is required")
+		}
+
+		var waitUntil *timestamppb.Timestamp
+		if engineStartOpts.WaitUntil != "" {
+			t, err := parseWaitUntil(engineStartOpts.WaitUntil)
+			if err != nil {
+				return err
+			}
+			waitUntil = timestamppb.New(t)
+		}
+
+		conn := dial()
+		defer conn.Close()
+		client := v1.NewSessionServiceClient(conn)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var (
+			resp *v1.StartEngineResponse
+			err  error
+		)
+		if engineStartOpts.Replay != "" {
+			resp, err = client.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{
+				PreviousEngine: engineStartOpts.Replay,
+				WaitUntil:      waitUntil,
+			})
+		} else {
+			var spec []byte
+			if args[0] == "-" {
+				spec, err = ioutil.ReadAll(os.Stdin)
+			} else {
+				spec, err = ioutil.ReadFile(args[0])
+			}
+			if err != nil {
+				return err
+			}
+
+			md := &v1.EngineMetadata{
+				Owner:   engineStartOpts.Owner,
+				Trigger: v1.EngineTrigger_TRIGGER_MANUAL,
+				Created: timestamppb.Now(),
+			}
+			for k, v := range engineStartOpts.Annotations {
+				md.Annotations = append(md.Annotations, &v1.Annotation{Key: k, Value: v})
+			}
+			resp, err = client.StartEngine(ctx, &v1.StartEngineRequest{
+				Metadata:   md,
+				EngineYaml: spec,
+				WaitUntil:  waitUntil,
+				NameSuffix: engineStartOpts.NameSuffix,
+			})
+		}
+		if err != nil {
+			return err
+		}
+
+		if !engineStartOpts.Follow {
+			return printEngines(os.Stdout, resp.Status)
+		}
+		return listen(context.Background(), client, resp.Status.Name, v1.ListenRequestLogs_LOGS_RAW, true)
+	},
+}
+
+func init() {
+	engineCmd.AddCommand(engineStartCmd)
+
+	engineStartCmd.Flags().StringVar(&engineStartOpts.Owner, "owner", os.Getenv("USER"), "owner of the engine")
+	engineStartCmd.Flags().StringVar(&engineStartOpts.NameSuffix, "name-suffix", "", "suffix appended to the engine name")
+	engineStartCmd.Flags().StringToStringVarP(&engineStartOpts.Annotations, "annotation", "a", nil, "annotations to add to the engine, e.g. team=checkout")
+	engineStartCmd.Flags().StringVar(&engineStartOpts.WaitUntil, "wait-until", "", "delay the start, either a duration (e.g. 10m) or an RFC3339 timestamp")
+	engineStartCmd.Flags().StringVar(&engineStartOpts.Replay, "replay", "", "start from the spec of a previous engine instead")
+	engineStartCmd.Flags().BoolVarP(&engineStartOpts.Follow, "follow", "f", false, "listen to the engine once it has started")
+}
+
+func parseWaitUntil(v string) (time.Time, error) {
+	if d, err := time.ParseDuration(v); err == nil {
+		return time.Now().Add(d), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --wait-until %q: must be a duration or RFC3339 timestamp", v)
+	}
+	return t, nil
+}
@@ -0,0 +1,206 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/yaml"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	"github.com/bhojpur/session/pkg/server"
+)
+
+var engineCmdOpts struct {
+	Output string
+}
+
+// engineCmd represents the engine command
+var engineCmd = &cobra.Command{
+	Use:   "engine",
+	Short: "Starts, inspects and stops session engines running in the Bhojpur Session server",
+}
+
+func init() {
+	rootCmd.AddCommand(engineCmd)
+
+	engineCmd.PersistentFlags().StringVarP(&engineCmdOpts.Output, "output", "o", "table", "output format: table, json or yaml")
+}
+
+// filterOps maps the operators accepted on the command line to filter operations.
+// Longer operators must come first so that they are matched before their prefixes.
+var filterOps = []struct {
+	Op     string
+	Filter v1.FilterOp
+	Negate bool
+}{
+	{"!=", v1.FilterOp_OP_EQUALS, true},
+	{"==", v1.FilterOp_OP_EQUALS, false},
+	{"~=", v1.FilterOp_OP_CONTAINS, false},
+	{"|=", v1.FilterOp_OP_STARTS_WITH, false},
+	{"=|", v1.FilterOp_OP_ENDS_WITH, false},
+}
+
+// parseFilter parses filter expressions from the command line. Each argument
+// is an expression and all expressions must match. An expression consists of
+// comma separated terms of which any must match, e.g.
+//
+//	phase==running,phase==starting owner~=bhojpur !annotation.test
+//
+// Supported operators are == (equals), != (not equals), ~= (contains),
+// |= (starts with) and =| (ends with). A field without operator matches if
+// the field exists, prefixed with ! if it does not.
+func parseFilter(args []string) ([]*v1.FilterExpression, error) {
+	res := make([]*v1.FilterExpression, 0, len(args))
+	for _, arg := range args {
+		var expr v1.FilterExpression
+		for _, t := range strings.Split(arg, ",") {
+			term, err := parseFilterTerm(t)
+			if err != nil {
+				return nil, err
+			}
+			expr.Terms = append(expr.Terms, term)
+		}
+		res = append(res, &expr)
+	}
+	return res, nil
+}
+
+// parseFilterTerm splits a term at its first operator, so that values may
+// contain operators themselves
+func parseFilterTerm(t string) (*v1.FilterTerm, error) {
+	t = strings.TrimSpace(t)
+	at, match := -1, -1
+	for i, op := range filterOps {
+		idx := strings.Index(t, op.Op)
+		if idx < 0 {
+			continue
+		}
+		if at < 0 || idx < at || idx == at && len(op.Op) > len(filterOps[match].Op) {
+			at, match = idx, i
+		}
+	}
+	if match >= 0 {
+		op := filterOps[match]
+		field := t[:at]
+		if field == "" {
+			return nil, fmt.Errorf("invalid filter %q: missing field", t)
+		}
+		return &v1.FilterTerm{
+			Field:     field,
+			Value:     t[at+len(op.Op):],
+			Operation: op.Filter,
+			Negate:    op.Negate,
+		}, nil
+	}
+
+	field := strings.TrimPrefix(t, "!")
+	if field == "" || strings.ContainsAny(field, "=~|") {
+		return nil, fmt.Errorf("invalid filter %q", t)
+	}
+	return &v1.FilterTerm{
+		Field:     field,
+		Operation: v1.FilterOp_OP_EXISTS,
+		Negate:    field != t,
+	}, nil
+}
+
+// parseOrder parses order expressions like created:desc or name:asc
+func parseOrder(args []string) ([]*v1.OrderExpression, error) {
+	res := make([]*v1.OrderExpression, 0, len(args))
+	for _, arg := range args {
+		segs := strings.Split(arg, ":")
+		expr := &v1.OrderExpression{Field: segs[0], Ascending: true}
+		if len(segs) == 2 {
+			switch segs[1] {
+			case "asc":
+			case "desc":
+				expr.Ascending = false
+			default:
+				return nil, fmt.Errorf("invalid order %q: direction must be asc or desc", arg)
+			}
+		} else if len(segs) > 2 {
+			return nil, fmt.Errorf("invalid order %q", arg)
+		}
+		res = append(res, expr)
+	}
+	return res, nil
+}
+
+// printEngines renders engine status in the format selected by --output
+func printEngines(out io.Writer, engines ...*v1.EngineStatus) error {
+	switch engineCmdOpts.Output {
+	case "json", "yaml":
+		var msg proto.Message
+		if len(engines) == 1 {
+			msg = engines[0]
+		} else {
+			msg = &v1.ListEnginesResponse{Total: int32(len(engines)), Result: engines}
+		}
+		return printProto(out, engineCmdOpts.Output, msg)
+	case "table":
+	default:
+		return fmt.Errorf("unknown output format %q", engineCmdOpts.Output)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tPHASE\tSUCCESS\tOWNER\tSPEC\tCREATED")
+	for _, e := range engines {
+		var (
+			owner, spec, created string
+		)
+		if md := e.Metadata; md != nil {
+			owner, spec = md.Owner, md.EngineSpecName
+			if md.Created != nil {
+				created = md.Created.AsTime().Local().Format(time.RFC3339)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\t%s\n", e.Name, server.PhaseName(e.Phase), e.Conditions.GetSuccess(), owner, spec, created)
+	}
+	return tw.Flush()
+}
+
+// printProto renders a single message as JSON or YAML
+func printProto(out io.Writer, format string, msg proto.Message) error {
+	b, err := protojson.MarshalOptions{Indent: "  "}.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+	case "yaml":
+		b, err = yaml.JSONToYAML(b)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	_, err = fmt.Fprintln(out, strings.TrimSpace(string(b)))
+	return err
+}
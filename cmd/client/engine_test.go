@@ -0,0 +1,86 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/proto"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		Args        []string
+		Expectation []*v1.FilterExpression
+		Error       bool
+	}{
+		{
+			Args: []string{"phase==running,phase==waiting"},
+			Expectation: []*v1.FilterExpression{{Terms: []*v1.FilterTerm{
+				{Field: "phase", Value: "running", Operation: v1.FilterOp_OP_EQUALS},
+				{Field: "phase", Value: "waiting", Operation: v1.FilterOp_OP_EQUALS},
+			}}},
+		},
+		{
+			Args: []string{"owner!=root", "name|=redis", "name=|.1", "spec~=cache"},
+			Expectation: []*v1.FilterExpression{
+				{Terms: []*v1.FilterTerm{{Field: "owner", Value: "root", Operation: v1.FilterOp_OP_EQUALS, Negate: true}}},
+				{Terms: []*v1.FilterTerm{{Field: "name", Value: "redis", Operation: v1.FilterOp_OP_STARTS_WITH}}},
+				{Terms: []*v1.FilterTerm{{Field: "name", Value: ".1", Operation: v1.FilterOp_OP_ENDS_WITH}}},
+				{Terms: []*v1.FilterTerm{{Field: "spec", Value: "cache", Operation: v1.FilterOp_OP_CONTAINS}}},
+			},
+		},
+		{
+			Args: []string{"annotation.team", "!annotation.test"},
+			Expectation: []*v1.FilterExpression{
+				{Terms: []*v1.FilterTerm{{Field: "annotation.team", Operation: v1.FilterOp_OP_EXISTS}}},
+				{Terms: []*v1.FilterTerm{{Field: "annotation.test", Operation: v1.FilterOp_OP_EXISTS, Negate: true}}},
+			},
+		},
+		{
+			Args: []string{"annotation.x~=a==b", "name==a!=b"},
+			Expectation: []*v1.FilterExpression{
+				{Terms: []*v1.FilterTerm{{Field: "annotation.x", Value: "a==b", Operation: v1.FilterOp_OP_CONTAINS}}},
+				{Terms: []*v1.FilterTerm{{Field: "name", Value: "a!=b", Operation: v1.FilterOp_OP_EQUALS}}},
+			},
+		},
+		{Args: []string{"==running"}, Error: true},
+		{Args: []string{"!"}, Error: true},
+	}
+
+	for _, test := range tests {
+		res, err := parseFilter(test.Args)
+		if test.Error {
+			assert.Error(t, err, test.Args)
+			continue
+		}
+		if !assert.NoError(t, err, test.Args) {
+			continue
+		}
+		assert.Len(t, res, len(test.Expectation), test.Args)
+		for i := range res {
+			assert.True(t, proto.Equal(test.Expectation[i], res[i]), "%v: expected %v, got %v", test.Args, test.Expectation[i], res[i])
+		}
+	}
+}
@@ -26,6 +26,7 @@ import (
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -42,6 +43,9 @@ var rootCmdOpts struct {
 var rootCmd = &cobra.Command{
 	Use:   "sessionctl",
 	Short: "Bhojpur Sessionctl is a command & control engine for session management services",
+	// errors are printed by Execute
+	SilenceErrors: true,
+	SilenceUsage:  true,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
 		if verbose {
 			log.SetLevel(log.DebugLevel)
@@ -63,6 +67,15 @@ const (
 	dialModeHost = "host"
 )
 
+// dial connects to the Bhojpur Session server given by the --host flag
+func dial() *grpc.ClientConn {
+	conn, err := grpc.Dial(rootCmdOpts.Host, grpc.WithInsecure())
+	if err != nil {
+		log.WithError(err).Fatal("cannot connect to Bhojpur Session server")
+	}
+	return conn
+}
+
 func init() {
 	sessionHost := os.Getenv("SESSION_HOST")
 	if sessionHost == "" {
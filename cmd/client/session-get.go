@@ -0,0 +1,74 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+)
+
+// sessionGetCmd represents the session get command
+var sessionGetCmd = &cobra.Command{
+	Use:   "get <sid> [key...]",
+	Short: "Lists the keys of a session, or prints the values of the given keys",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		provider, err := openProvider()
+		if err != nil {
+			return err
+		}
+		store, err := readSession(ctx, provider, args[0])
+		if err != nil {
+			return err
+		}
+		values, err := sessionValues(ctx, store)
+		if err != nil {
+			return err
+		}
+		if len(args) == 1 {
+			return printKeys(os.Stdout, values)
+		}
+
+		wanted := make(map[string]struct{}, len(args)-1)
+		for _, k := range args[1:] {
+			wanted[k] = struct{}{}
+		}
+		res := make(map[interface{}]interface{}, len(wanted))
+		for k, v := range values {
+			if _, ok := wanted[v1.ValueKey(k)]; ok {
+				res[k] = v
+			}
+		}
+		return printValues(os.Stdout, res)
+	},
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionGetCmd)
+}
@@ -0,0 +1,106 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+var sessionRegenerateOpts struct {
+	SessionIDLength int64
+	SessionIDPrefix string
+}
+
+// sessionRegenerateCmd represents the session regenerate command
+var sessionRegenerateCmd = &cobra.Command{
+	Use:   "regenerate <sid> [new-sid]",
+	Short: "Moves a session to a new session ID and prints the new ID",
+	Long: `Moves a session to a new session ID and prints the new ID.
+
+Unless given, the new session ID is generated by the session manager: by the
+server's manager of the engine, or with --provider by a manager configured
+with --sid-length and --sid-prefix.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if sessionCmdOpts.Provider == "" {
+			newsid := ""
+			if len(args) == 2 {
+				newsid = args[1]
+			}
+			conn := dial()
+			defer conn.Close()
+			resp, err := v1.NewSessionStoreClient(conn).RegenerateSession(ctx, &v1.RegenerateSessionRequest{
+				Engine:       sessionCmdOpts.Engine,
+				SessionId:    args[0],
+				NewSessionId: newsid,
+			})
+			if err != nil {
+				return err
+			}
+			fmt.Println(resp.SessionId)
+			return nil
+		}
+
+		manager, err := openManager(
+			session.CfgSessionIdLength(sessionRegenerateOpts.SessionIDLength),
+			session.CfgSessionIdPrefix(sessionRegenerateOpts.SessionIDPrefix),
+		)
+		if err != nil {
+			return err
+		}
+		provider := manager.GetProvider()
+		exists, err := provider.SessionExist(ctx, args[0])
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("session %s does not exist", args[0])
+		}
+		var store session.Store
+		if len(args) == 2 {
+			store, err = provider.SessionRegenerate(ctx, args[0], args[1])
+		} else {
+			store, err = manager.SessionRegenerateWithID(ctx, args[0])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Println(store.SessionID(ctx))
+		return nil
+	},
+}
+
+func init() {
+	sessionCmd.AddCommand(sessionRegenerateCmd)
+
+	sessionRegenerateCmd.Flags().Int64Var(&sessionRegenerateOpts.SessionIDLength, "sid-length", 16, "number of random bytes in a session ID generated with --provider")
+	sessionRegenerateCmd.Flags().StringVar(&sessionRegenerateOpts.SessionIDPrefix, "sid-prefix", "", "prefix of a session ID generated with --provider")
+}
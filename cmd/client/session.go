@@ -0,0 +1,177 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	session "github.com/bhojpur/session/pkg/engine"
+	_ "github.com/bhojpur/session/pkg/provider/grpc"
+)
+
+var sessionCmdOpts struct {
+	Provider       string
+	ProviderConfig string
+	Engine         string
+	Maxlifetime    int64
+	Serializer     string
+	EncryptionKeys []string
+	Output         string
+}
+
+// sessionCmd represents the session command
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Inspects and manages live sessions",
+	Long: `Inspects and manages live sessions.
+
+By default sessions are accessed through the Bhojpur Session server given by
+--host, using the engine selected by --engine (or the server's default engine).
+Alternatively --provider and --provider-config access a session store directly,
+using the same configuration an application would pass to the provider.`,
+	Example: `  sessionctl session count --engine redis.1
+  sessionctl session dump 2f1c... --provider redis --provider-config 127.0.0.1:6379`,
+}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+
+	sessionCmd.PersistentFlags().StringVar(&sessionCmdOpts.Provider, "provider", "", "access the session store directly using this provider instead of the Bhojpur Session server")
+	sessionCmd.PersistentFlags().StringVar(&sessionCmdOpts.ProviderConfig, "provider-config", "", "provider configuration, as it would be passed to the provider by the session manager")
+	sessionCmd.PersistentFlags().StringVar(&sessionCmdOpts.Engine, "engine", "", "engine of the Bhojpur Session server to use (defaults to the server's default engine)")
+	sessionCmd.PersistentFlags().Int64Var(&sessionCmdOpts.Maxlifetime, "maxlifetime", 3600, "session lifetime in seconds the provider is initialised with")
+	sessionCmd.PersistentFlags().StringVar(&sessionCmdOpts.Serializer, "serializer", "", "serializer the provider stores session values with, e.g. gob, json, msgpack or cbor (defaults to gob)")
+	sessionCmd.PersistentFlags().StringArrayVar(&sessionCmdOpts.EncryptionKeys, "encryption-key", nil, "id=key of the keyring encrypting stored sessions, newest first; repeat for retired keys")
+	sessionCmd.PersistentFlags().StringVarP(&sessionCmdOpts.Output, "output", "o", "json", "output format: json or yaml")
+}
+
+// openProvider initialises the provider selected by the session command flags
+func openProvider() (session.Provider, error) {
+	manager, err := openManager()
+	if err != nil {
+		return nil, err
+	}
+	return manager.GetProvider(), nil
+}
+
+// openManager creates a session manager for the provider selected by the
+// session command flags, configured as an application would configure it
+func openManager(opts ...session.ManagerConfigOpt) (*session.Manager, error) {
+	name, config := sessionCmdOpts.Provider, sessionCmdOpts.ProviderConfig
+	if name == "" {
+		cfg, err := json.Marshal(map[string]string{
+			"addr":   rootCmdOpts.Host,
+			"engine": sessionCmdOpts.Engine,
+		})
+		if err != nil {
+			return nil, err
+		}
+		name, config = string(session.ProviderRemote), string(cfg)
+	}
+
+	provider, err := session.GetProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := provider.(session.SerializerSetter); !ok && (sessionCmdOpts.Serializer != "" || len(sessionCmdOpts.EncryptionKeys) > 0) {
+		return nil, fmt.Errorf("the %s provider does not support serializers", name)
+	}
+	keys := make([]session.EncryptionKey, len(sessionCmdOpts.EncryptionKeys))
+	for i, key := range sessionCmdOpts.EncryptionKeys {
+		parts := strings.SplitN(key, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid encryption key %q, expected id=key", key)
+		}
+		keys[i] = session.EncryptionKey{ID: parts[0], Key: parts[1]}
+	}
+	// compressed sessions are read without a compressor too
+	opts = append([]session.ManagerConfigOpt{
+		session.CfgMaxLifeTime(sessionCmdOpts.Maxlifetime),
+		session.CfgProviderConfig(config),
+		session.CfgSerializerName(sessionCmdOpts.Serializer),
+		session.CfgEncryptionKeys(keys...),
+	}, opts...)
+	manager, err := session.NewManager(name, session.NewManagerConfig(opts...))
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialise %s provider: %w", name, err)
+	}
+	return manager, nil
+}
+
+// readSession reads an existing session. Unlike SessionRead it does not
+// create the session if it does not exist.
+func readSession(ctx context.Context, provider session.Provider, sid string) (session.Store, error) {
+	exists, err := provider.SessionExist(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("session %s does not exist", sid)
+	}
+	return provider.SessionRead(ctx, sid)
+}
+
+// sessionValues returns the decoded values of a session
+func sessionValues(ctx context.Context, store session.Store) (map[interface{}]interface{}, error) {
+	lister, ok := store.(session.ValueLister)
+	if !ok {
+		return nil, fmt.Errorf("session store %T cannot list its values", store)
+	}
+	return lister.Values(ctx), nil
+}
+
+// printValues renders session values as JSON or YAML. Keys are rendered as strings.
+func printValues(out io.Writer, values map[interface{}]interface{}) error {
+	fields, err := v1.NewValues(values)
+	if err != nil {
+		return err
+	}
+	return printProto(out, sessionCmdOpts.Output, &structpb.Struct{Fields: fields})
+}
+
+// printKeys renders the keys of a session and the Go type of their values
+func printKeys(out io.Writer, values map[interface{}]interface{}) error {
+	keys := make([]string, 0, len(values))
+	types := make(map[string]string, len(values))
+	for k, v := range values {
+		key := v1.ValueKey(k)
+		keys = append(keys, key)
+		types[key] = fmt.Sprintf("%T", v)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tTYPE")
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", k, types[k])
+	}
+	return tw.Flush()
+}
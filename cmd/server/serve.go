@@ -0,0 +1,102 @@
+package cmd
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	"github.com/bhojpur/session/pkg/server"
+)
+
+var serveCmdOpts struct {
+	GRPCAddr         string
+	DefaultEngine    string
+	AcceptSessionIDs bool
+}
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Starts the Bhojpur Session gRPC server",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lis, err := net.Listen("tcp", serveCmdOpts.GRPCAddr)
+		if err != nil {
+			return err
+		}
+
+		engines := server.NewRegistry()
+		var defaultEngine string
+		if serveCmdOpts.DefaultEngine != "" {
+			engineYAML, err := ioutil.ReadFile(serveCmdOpts.DefaultEngine)
+			if err != nil {
+				return err
+			}
+			status, err := engines.Start(&v1.EngineMetadata{EngineSpecName: "default"}, engineYAML, "", time.Time{})
+			if err != nil {
+				return fmt.Errorf("cannot start default engine: %w", err)
+			}
+			defaultEngine = status.Name
+			log.WithField("name", defaultEngine).Info("started default engine")
+		}
+
+		grpcServer := grpc.NewServer()
+		v1.RegisterSessionServiceServer(grpcServer, server.NewService(engines))
+		store := server.NewStoreService(engines, defaultEngine)
+		store.AcceptSessionIDs = serveCmdOpts.AcceptSessionIDs
+		v1.RegisterSessionStoreServer(grpcServer, store)
+
+		go func() {
+			sigChan := make(chan os.Signal, 1)
+			signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+			<-sigChan
+
+			log.Info("shutting down")
+			engines.Close()
+			grpcServer.GracefulStop()
+		}()
+
+		log.WithField("addr", lis.Addr().String()).Info("serving Bhojpur Session gRPC API")
+		return grpcServer.Serve(lis)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+
+	grpcAddr := os.Getenv("SESSION_GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = ":7777"
+	}
+	serveCmd.Flags().StringVar(&serveCmdOpts.DefaultEngine, "default-engine", os.Getenv("SESSION_DEFAULT_ENGINE"), "engine YAML file of the engine started on boot and used by session requests which name no engine (defaults to SESSION_DEFAULT_ENGINE env var)")
+	serveCmd.Flags().BoolVar(&serveCmdOpts.AcceptSessionIDs, "accept-session-ids", os.Getenv("SESSION_ACCEPT_SESSION_IDS") == "true", "let clients choose session IDs, needed by the remote provider; only enable it for trusted clients (defaults to SESSION_ACCEPT_SESSION_IDS env var)")
+	serveCmd.Flags().StringVar(&serveCmdOpts.GRPCAddr, "grpc-addr", grpcAddr, "address the gRPC API listens on (defaults to SESSION_GRPC_ADDR env var)")
+}
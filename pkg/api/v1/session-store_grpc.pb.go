@@ -0,0 +1,369 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package v1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// SessionStoreClient is the client API for SessionStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SessionStoreClient interface {
+	// CreateSession creates a new session, optionally with initial values.
+	CreateSession(ctx context.Context, in *CreateSessionRequest, opts ...grpc.CallOption) (*CreateSessionResponse, error)
+	// SessionExists checks if a session exists
+	SessionExists(ctx context.Context, in *SessionExistsRequest, opts ...grpc.CallOption) (*SessionExistsResponse, error)
+	// GetSession reads the values of a session
+	GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*GetSessionResponse, error)
+	// SetValues sets values of a session
+	SetValues(ctx context.Context, in *SetValuesRequest, opts ...grpc.CallOption) (*SetValuesResponse, error)
+	// DeleteValues removes values from a session
+	DeleteValues(ctx context.Context, in *DeleteValuesRequest, opts ...grpc.CallOption) (*DeleteValuesResponse, error)
+	// RegenerateSession moves a session to a new session ID
+	RegenerateSession(ctx context.Context, in *RegenerateSessionRequest, opts ...grpc.CallOption) (*RegenerateSessionResponse, error)
+	// DestroySession removes a session
+	DestroySession(ctx context.Context, in *DestroySessionRequest, opts ...grpc.CallOption) (*DestroySessionResponse, error)
+	// CountSessions returns the number of active sessions
+	CountSessions(ctx context.Context, in *CountSessionsRequest, opts ...grpc.CallOption) (*CountSessionsResponse, error)
+}
+
+type sessionStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSessionStoreClient(cc grpc.ClientConnInterface) SessionStoreClient {
+	return &sessionStoreClient{cc}
+}
+
+func (c *sessionStoreClient) CreateSession(ctx context.Context, in *CreateSessionRequest, opts ...grpc.CallOption) (*CreateSessionResponse, error) {
+	out := new(CreateSessionResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/CreateSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionStoreClient) SessionExists(ctx context.Context, in *SessionExistsRequest, opts ...grpc.CallOption) (*SessionExistsResponse, error) {
+	out := new(SessionExistsResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/SessionExists", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionStoreClient) GetSession(ctx context.Context, in *GetSessionRequest, opts ...grpc.CallOption) (*GetSessionResponse, error) {
+	out := new(GetSessionResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/GetSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionStoreClient) SetValues(ctx context.Context, in *SetValuesRequest, opts ...grpc.CallOption) (*SetValuesResponse, error) {
+	out := new(SetValuesResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/SetValues", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionStoreClient) DeleteValues(ctx context.Context, in *DeleteValuesRequest, opts ...grpc.CallOption) (*DeleteValuesResponse, error) {
+	out := new(DeleteValuesResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/DeleteValues", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionStoreClient) RegenerateSession(ctx context.Context, in *RegenerateSessionRequest, opts ...grpc.CallOption) (*RegenerateSessionResponse, error) {
+	out := new(RegenerateSessionResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/RegenerateSession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionStoreClient) DestroySession(ctx context.Context, in *DestroySessionRequest, opts ...grpc.CallOption) (*DestroySessionResponse, error) {
+	out := new(DestroySessionResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/DestroySession", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionStoreClient) CountSessions(ctx context.Context, in *CountSessionsRequest, opts ...grpc.CallOption) (*CountSessionsResponse, error) {
+	out := new(CountSessionsResponse)
+	err := c.cc.Invoke(ctx, "/v1.SessionStore/CountSessions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SessionStoreServer is the server API for SessionStore service.
+// All implementations must embed UnimplementedSessionStoreServer
+// for forward compatibility
+type SessionStoreServer interface {
+	// CreateSession creates a new session, optionally with initial values.
+	CreateSession(context.Context, *CreateSessionRequest) (*CreateSessionResponse, error)
+	// SessionExists checks if a session exists
+	SessionExists(context.Context, *SessionExistsRequest) (*SessionExistsResponse, error)
+	// GetSession reads the values of a session
+	GetSession(context.Context, *GetSessionRequest) (*GetSessionResponse, error)
+	// SetValues sets values of a session
+	SetValues(context.Context, *SetValuesRequest) (*SetValuesResponse, error)
+	// DeleteValues removes values from a session
+	DeleteValues(context.Context, *DeleteValuesRequest) (*DeleteValuesResponse, error)
+	// RegenerateSession moves a session to a new session ID
+	RegenerateSession(context.Context, *RegenerateSessionRequest) (*RegenerateSessionResponse, error)
+	// DestroySession removes a session
+	DestroySession(context.Context, *DestroySessionRequest) (*DestroySessionResponse, error)
+	// CountSessions returns the number of active sessions
+	CountSessions(context.Context, *CountSessionsRequest) (*CountSessionsResponse, error)
+	mustEmbedUnimplementedSessionStoreServer()
+}
+
+// UnimplementedSessionStoreServer must be embedded to have forward compatible implementations.
+type UnimplementedSessionStoreServer struct {
+}
+
+func (UnimplementedSessionStoreServer) CreateSession(context.Context, *CreateSessionRequest) (*CreateSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSession not implemented")
+}
+func (UnimplementedSessionStoreServer) SessionExists(context.Context, *SessionExistsRequest) (*SessionExistsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SessionExists not implemented")
+}
+func (UnimplementedSessionStoreServer) GetSession(context.Context, *GetSessionRequest) (*GetSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSession not implemented")
+}
+func (UnimplementedSessionStoreServer) SetValues(context.Context, *SetValuesRequest) (*SetValuesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetValues not implemented")
+}
+func (UnimplementedSessionStoreServer) DeleteValues(context.Context, *DeleteValuesRequest) (*DeleteValuesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteValues not implemented")
+}
+func (UnimplementedSessionStoreServer) RegenerateSession(context.Context, *RegenerateSessionRequest) (*RegenerateSessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegenerateSession not implemented")
+}
+func (UnimplementedSessionStoreServer) DestroySession(context.Context, *DestroySessionRequest) (*DestroySessionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DestroySession not implemented")
+}
+func (UnimplementedSessionStoreServer) CountSessions(context.Context, *CountSessionsRequest) (*CountSessionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CountSessions not implemented")
+}
+func (UnimplementedSessionStoreServer) mustEmbedUnimplementedSessionStoreServer() {}
+
+// UnsafeSessionStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SessionStoreServer will
+// result in compilation errors.
+type UnsafeSessionStoreServer interface {
+	mustEmbedUnimplementedSessionStoreServer()
+}
+
+func RegisterSessionStoreServer(s grpc.ServiceRegistrar, srv SessionStoreServer) {
+	s.RegisterService(&SessionStore_ServiceDesc, srv)
+}
+
+func _SessionStore_CreateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).CreateSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/CreateSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).CreateSession(ctx, req.(*CreateSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionStore_SessionExists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SessionExistsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).SessionExists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/SessionExists",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).SessionExists(ctx, req.(*SessionExistsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionStore_GetSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).GetSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/GetSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).GetSession(ctx, req.(*GetSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionStore_SetValues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetValuesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).SetValues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/SetValues",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).SetValues(ctx, req.(*SetValuesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionStore_DeleteValues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteValuesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).DeleteValues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/DeleteValues",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).DeleteValues(ctx, req.(*DeleteValuesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionStore_RegenerateSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegenerateSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).RegenerateSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/RegenerateSession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).RegenerateSession(ctx, req.(*RegenerateSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionStore_DestroySession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DestroySessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).DestroySession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/DestroySession",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).DestroySession(ctx, req.(*DestroySessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionStore_CountSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionStoreServer).CountSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/v1.SessionStore/CountSessions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionStoreServer).CountSessions(ctx, req.(*CountSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SessionStore_ServiceDesc is the grpc.ServiceDesc for SessionStore service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SessionStore_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "v1.SessionStore",
+	HandlerType: (*SessionStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateSession",
+			Handler:    _SessionStore_CreateSession_Handler,
+		},
+		{
+			MethodName: "SessionExists",
+			Handler:    _SessionStore_SessionExists_Handler,
+		},
+		{
+			MethodName: "GetSession",
+			Handler:    _SessionStore_GetSession_Handler,
+		},
+		{
+			MethodName: "SetValues",
+			Handler:    _SessionStore_SetValues_Handler,
+		},
+		{
+			MethodName: "DeleteValues",
+			Handler:    _SessionStore_DeleteValues_Handler,
+		},
+		{
+			MethodName: "RegenerateSession",
+			Handler:    _SessionStore_RegenerateSession_Handler,
+		},
+		{
+			MethodName: "DestroySession",
+			Handler:    _SessionStore_DestroySession_Handler,
+		},
+		{
+			MethodName: "CountSessions",
+			Handler:    _SessionStore_CountSessions_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "session-store.proto",
+}
@@ -0,0 +1,108 @@
+package v1
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// NewValues converts session values to their protobuf representation.
+// Keys which are not strings are formatted using fmt.Sprint. Values which
+// have no direct protobuf representation are converted through their JSON
+// encoding.
+func NewValues(values map[interface{}]interface{}) (map[string]*structpb.Value, error) {
+	res := make(map[string]*structpb.Value, len(values))
+	for k, v := range values {
+		pv, err := NewValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert value of %v: %w", k, err)
+		}
+		res[ValueKey(k)] = pv
+	}
+	return res, nil
+}
+
+// NewValue converts a single session value to its protobuf representation
+func NewValue(v interface{}) (*structpb.Value, error) {
+	v = normalizeValue(v)
+	if pv, err := structpb.NewValue(v); err == nil {
+		return pv, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	err = json.Unmarshal(b, &generic)
+	if err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(generic)
+}
+
+// ValueKey returns the string representation of a session key
+func ValueKey(k interface{}) string {
+	if s, ok := k.(string); ok {
+		return s
+	}
+	return fmt.Sprint(k)
+}
+
+// normalizeValue turns nested maps with non-string keys into maps with
+// string keys, so that they can be represented as protobuf structs.
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			res[ValueKey(k)] = normalizeValue(e)
+		}
+		return res
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(val))
+		for k, e := range val {
+			res[k] = normalizeValue(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(val))
+		for i, e := range val {
+			res[i] = normalizeValue(e)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// AsSessionValues converts protobuf values back to session values. Numbers
+// are returned as float64, structs as map[string]interface{}.
+func AsSessionValues(values map[string]*structpb.Value) map[interface{}]interface{} {
+	res := make(map[interface{}]interface{}, len(values))
+	for k, v := range values {
+		res[k] = v.AsInterface()
+	}
+	return res
+}
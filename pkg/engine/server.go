@@ -40,19 +40,66 @@ import (
 	"log"
 	"net/http"
 	"net/textproto"
-	"net/url"
 	"os"
+	"sync"
 	"time"
 )
 
 // Store contains all data for one session process with specific id.
+// This is version 2 of the store API, in which reading a value and releasing
+// the session report their errors. Stores implementing version 1 can be
+// adapted with AdaptStoreV1.
 type Store interface {
-	Set(ctx context.Context, key, value interface{}) error     // set session value
-	Get(ctx context.Context, key interface{}) interface{}      // get session value
-	Delete(ctx context.Context, key interface{}) error         // delete session value
-	SessionID(ctx context.Context) string                      // back current sessionID
-	SessionRelease(ctx context.Context, w http.ResponseWriter) // release the resource & save data to provider & return the data
-	Flush(ctx context.Context) error                           // delete all data
+	Set(ctx context.Context, key, value interface{}) error           // set session value
+	Get(ctx context.Context, key interface{}) (interface{}, error)   // get session value
+	Delete(ctx context.Context, key interface{}) error               // delete session value
+	SessionID(ctx context.Context) string                            // back current sessionID
+	SessionRelease(ctx context.Context, w http.ResponseWriter) error // release the resource & save data to provider
+	Flush(ctx context.Context) error                                 // delete all data
+}
+
+// StoreV1 is version 1 of the store API, which cannot report errors of
+// reading a value or releasing the session.
+type StoreV1 interface {
+	Set(ctx context.Context, key, value interface{}) error
+	Get(ctx context.Context, key interface{}) interface{}
+	Delete(ctx context.Context, key interface{}) error
+	SessionID(ctx context.Context) string
+	SessionRelease(ctx context.Context, w http.ResponseWriter)
+	Flush(ctx context.Context) error
+}
+
+// AdaptStoreV1 adapts a version 1 store to the Store API. The adapted store
+// never reports errors of Get and SessionRelease.
+func AdaptStoreV1(st StoreV1) Store {
+	if l, ok := st.(ValueLister); ok {
+		return &listingStoreV1{storeV1{st}, l}
+	}
+	return &storeV1{st}
+}
+
+type storeV1 struct {
+	StoreV1
+}
+
+func (st *storeV1) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	return st.StoreV1.Get(ctx, key), nil
+}
+
+func (st *storeV1) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	st.StoreV1.SessionRelease(ctx, w)
+	return nil
+}
+
+type listingStoreV1 struct {
+	storeV1
+	ValueLister
+}
+
+// ValueLister is implemented by stores which can return all of their values.
+// All built-in stores implement it.
+type ValueLister interface {
+	Values(ctx context.Context) map[interface{}]interface{} // copy of all session values
 }
 
 // Provider contains global session methods and saved SessionStores.
@@ -67,6 +114,71 @@ type Provider interface {
 	SessionGC(ctx context.Context)
 }
 
+// GCWithError is implemented by providers whose garbage collection can fail.
+// GCContext calls SessionGCWithError instead of SessionGC and reports the
+// error to the error hook.
+type GCWithError interface {
+	SessionGCWithError(ctx context.Context) error
+}
+
+// ProviderV1 is version 1 of the provider API, whose stores implement
+// StoreV1.
+type ProviderV1 interface {
+	SessionInit(ctx context.Context, gclifetime int64, config string) error
+	SessionRead(ctx context.Context, sid string) (StoreV1, error)
+	SessionExist(ctx context.Context, sid string) (bool, error)
+	SessionRegenerate(ctx context.Context, oldsid, sid string) (StoreV1, error)
+	SessionDestroy(ctx context.Context, sid string) error
+	SessionAll(ctx context.Context) int
+	SessionGC(ctx context.Context)
+}
+
+// AdaptProviderV1 adapts a version 1 provider to the Provider API, so that it
+// can be registered. Its stores are adapted with AdaptStoreV1.
+func AdaptProviderV1(p ProviderV1) Provider {
+	return &providerV1{p}
+}
+
+type providerV1 struct {
+	p ProviderV1
+}
+
+func (pv *providerV1) SessionInit(ctx context.Context, gclifetime int64, config string) error {
+	return pv.p.SessionInit(ctx, gclifetime, config)
+}
+
+func (pv *providerV1) SessionRead(ctx context.Context, sid string) (Store, error) {
+	st, err := pv.p.SessionRead(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	return AdaptStoreV1(st), nil
+}
+
+func (pv *providerV1) SessionExist(ctx context.Context, sid string) (bool, error) {
+	return pv.p.SessionExist(ctx, sid)
+}
+
+func (pv *providerV1) SessionRegenerate(ctx context.Context, oldsid, sid string) (Store, error) {
+	st, err := pv.p.SessionRegenerate(ctx, oldsid, sid)
+	if err != nil {
+		return nil, err
+	}
+	return AdaptStoreV1(st), nil
+}
+
+func (pv *providerV1) SessionDestroy(ctx context.Context, sid string) error {
+	return pv.p.SessionDestroy(ctx, sid)
+}
+
+func (pv *providerV1) SessionAll(ctx context.Context) int {
+	return pv.p.SessionAll(ctx)
+}
+
+func (pv *providerV1) SessionGC(ctx context.Context) {
+	pv.p.SessionGC(ctx)
+}
+
 var provides = make(map[string]Provider)
 
 // SLogger a helpful variable to log information about session
@@ -94,6 +206,13 @@ func GetProvider(name string) (Provider, error) {
 type Manager struct {
 	provider Provider
 	config   *ManagerConfig
+
+	locker  SessionLocker
+	locksMu sync.Mutex
+	locks   map[string]*sessionLock // session locks held by the manager
+
+	extractors []SidExtractor
+	writers    []SidWriter
 }
 
 // NewManager Create new Manager with provider name and json config string.
@@ -130,7 +249,55 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 		}
 	}
 
-	err := provider.SessionInit(nil, cf.Maxlifetime, cf.ProviderConfig)
+	serializer := cf.Serializer
+	if serializer == nil && cf.SerializerName != "" {
+		var err error
+		serializer, err = GetSerializer(cf.SerializerName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var compressor Compressor
+	if cf.Compression != "" {
+		var err error
+		compressor, err = GetCompressor(cf.Compression)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if setter, ok := provider.(SerializerSetter); ok {
+		if serializer == nil {
+			serializer = GobSerializer{}
+		}
+		// compressed payloads stay readable when compression is turned off
+		serializer = CompressSerializer(serializer, compressor, cf.MaxDecompressedSize)
+		if len(cf.EncryptionKeys) > 0 {
+			var err error
+			if serializer, err = EncryptSerializer(serializer, cf.EncryptionKeys, cf.AllowPlaintextSessions); err != nil {
+				return nil, err
+			}
+		}
+		setter.SetSerializer(serializer)
+	}
+
+	if checker, ok := provider.(VersionChecker); ok {
+		checker.SetVersionCheck(cf.EnableVersionCheck)
+	} else if cf.EnableVersionCheck {
+		return nil, fmt.Errorf("session: provider %q does not support version checks", provideName)
+	}
+
+	if cf.MaxUserSessions > 0 {
+		if _, ok := provider.(UserIndexer); !ok {
+			return nil, fmt.Errorf("session: provider %q does not index sessions by user", provideName)
+		}
+		switch cf.UserSessionPolicy {
+		case "", RejectNewSession, EvictOldestSession:
+		default:
+			return nil, fmt.Errorf("session: unknown user session policy %q", cf.UserSessionPolicy)
+		}
+	}
+
+	err := provider.SessionInit(context.Background(), cf.Maxlifetime, cf.ProviderConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -139,10 +306,21 @@ func NewManager(provideName string, cf *ManagerConfig) (*Manager, error) {
 		cf.SessionIDLength = 16
 	}
 
-	return &Manager{
-		provider,
-		cf,
-	}, nil
+	manager := &Manager{provider: provider, config: cf}
+	manager.extractors, manager.writers = manager.defaultSidTransports()
+	if cf.EnableSessionLock {
+		if manager.locker, ok = provider.(SessionLocker); !ok {
+			return nil, fmt.Errorf("session: provider %q does not support session locks", provideName)
+		}
+		if cf.SessionLockTimeout <= 0 {
+			cf.SessionLockTimeout = 10
+		}
+		if cf.SessionLockTTL <= 0 {
+			cf.SessionLockTTL = 60
+		}
+		manager.locks = make(map[string]*sessionLock)
+	}
+	return manager, nil
 }
 
 // GetProvider return current manager's provider
@@ -150,198 +328,297 @@ func (manager *Manager) GetProvider() Provider {
 	return manager.provider
 }
 
-// getSid retrieves session identifier from HTTP Request.
-// First try to retrieve id by reading from cookie, session cookie name is configurable,
-// if not exist, then retrieve id from querying parameters.
-//
-// error is not nil when there is anything wrong.
-// sid is empty when need to generate a new session id
-// otherwise return an valid session id.
-func (manager *Manager) getSid(r *http.Request) (string, error) {
-	cookie, errs := r.Cookie(manager.config.CookieName)
-	if errs != nil || cookie.Value == "" {
-		var sid string
-		if manager.config.EnableSidInURLQuery {
-			errs := r.ParseForm()
-			if errs != nil {
-				return "", errs
-			}
-
-			sid = r.FormValue(manager.config.CookieName)
-		}
-
-		// if not found in Cookie / param, then read it from request headers
-		if manager.config.EnableSidInHTTPHeader && sid == "" {
-			sids, isFound := r.Header[manager.config.SessionNameInHTTPHeader]
-			if isFound && len(sids) != 0 {
-				return sids[0], nil
-			}
-		}
-
-		return sid, nil
-	}
-
-	// HTTP Request contains cookie for sessionid info.
-	return url.QueryUnescape(cookie.Value)
-}
-
 // SessionStart generate or read the session id from http request.
 // if session id exists, return SessionStore with this id.
+// The provider is accessed with the context of the request.
 func (manager *Manager) SessionStart(w http.ResponseWriter, r *http.Request) (session Store, err error) {
+	ctx := contextWithRequest(r)
 	sid, errs := manager.getSid(r)
 	if errs != nil {
 		return nil, errs
 	}
 
-	if sid != "" {
-		exists, err := manager.provider.SessionExist(nil, sid)
-		if err != nil {
-			return nil, err
-		}
-		if exists {
-			return manager.provider.SessionRead(nil, sid)
-		}
+	session, created, err := manager.start(ctx, sid)
+	if err != nil || !created {
+		return session, err
 	}
+	manager.writeSid(w, r, session.SessionID(ctx))
+	return
+}
 
-	// Generate a new session
-	sid, errs = manager.sessionID()
-	if errs != nil {
-		return nil, errs
-	}
+// SessionStartWithID reads the session sid, or starts a new session if sid is
+// empty or does not exist, for transports other than HTTP. The caller passes
+// the ID of the returned session back to the client.
+func (manager *Manager) SessionStartWithID(ctx context.Context, sid string) (Store, error) {
+	session, _, err := manager.start(ctx, sid)
+	return session, err
+}
 
-	session, err = manager.provider.SessionRead(nil, sid)
+// ErrSessionNotExist is returned by ReadSession for sessions which do not
+// exist, expired or were revoked
+var ErrSessionNotExist = errors.New("session: session does not exist")
+
+// ReadSession reads the existing session sid with the lock and the
+// expiration policies of SessionStart, for transports other than HTTP.
+// Expired and revoked sessions are destroyed and ErrSessionNotExist is
+// returned for them, as for sessions which do not exist.
+func (manager *Manager) ReadSession(ctx context.Context, sid string) (session Store, err error) {
+	exists, err := manager.provider.SessionExist(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrSessionNotExist
+	}
+	if manager.locker != nil {
+		session, err = manager.readLocked(ctx, sid)
+	} else {
+		session, err = manager.provider.SessionRead(ctx, sid)
+	}
 	if err != nil {
 		return nil, err
 	}
-	cookie := &http.Cookie{
-		Name:     manager.config.CookieName,
-		Value:    url.QueryEscape(sid),
-		Path:     "/",
-		HttpOnly: !manager.config.DisableHTTPOnly,
-		Secure:   manager.isSecure(r),
-		Domain:   manager.config.Domain,
-		SameSite: manager.config.CookieSameSite,
+	expired, err := manager.expired(ctx, session)
+	if err == nil && !expired {
+		err = manager.touch(ctx, session)
 	}
-	if manager.config.CookieLifeTime > 0 {
-		cookie.MaxAge = manager.config.CookieLifeTime
-		cookie.Expires = time.Now().Add(time.Duration(manager.config.CookieLifeTime) * time.Second)
+	if err != nil {
+		manager.unlockSession(sid)
+		return nil, err
 	}
-	if manager.config.EnableSetCookie {
-		http.SetCookie(w, cookie)
+	if expired {
+		manager.SessionDestroyWithID(ctx, sid)
+		return nil, ErrSessionNotExist
 	}
-	r.AddCookie(cookie)
+	return session, nil
+}
 
-	if manager.config.EnableSidInHTTPHeader {
-		r.Header.Set(manager.config.SessionNameInHTTPHeader, sid)
-		w.Header().Set(manager.config.SessionNameInHTTPHeader, sid)
+// start reads the session sid, or a new session which is reported as created
+func (manager *Manager) start(ctx context.Context, sid string) (session Store, created bool, err error) {
+	if sid != "" {
+		session, err = manager.ReadSession(ctx, sid)
+		// expired and revoked sessions are replaced by a new session
+		if err != ErrSessionNotExist {
+			return session, false, err
+		}
 	}
 
-	return
+	// Generate a new session
+	sid, err = manager.sessionID()
+	if err != nil {
+		return nil, false, err
+	}
+	session, err = manager.provider.SessionRead(ctx, sid)
+	if err == nil {
+		err = manager.touch(ctx, session)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return session, true, nil
+}
+
+type requestContextKey struct{}
+
+// contextWithRequest returns the context of r which also carries r itself
+func contextWithRequest(r *http.Request) context.Context {
+	return context.WithValue(r.Context(), requestContextKey{}, r)
+}
+
+// RequestFromContext returns the request a session is started for by
+// SessionStart or SessionRegenerateID, so that providers can read cookies
+// other than the session ID. It returns nil for other contexts.
+func RequestFromContext(ctx context.Context) *http.Request {
+	if ctx == nil {
+		return nil
+	}
+	r, _ := ctx.Value(requestContextKey{}).(*http.Request)
+	return r
 }
 
 // SessionDestroy Destroy session by its id in http request cookie.
 func (manager *Manager) SessionDestroy(w http.ResponseWriter, r *http.Request) {
-	if manager.config.EnableSidInHTTPHeader {
-		r.Header.Del(manager.config.SessionNameInHTTPHeader)
-		w.Header().Del(manager.config.SessionNameInHTTPHeader)
+	sid, err := manager.getSid(r)
+	if err != nil || sid == "" {
+		return
 	}
 
-	cookie, err := r.Cookie(manager.config.CookieName)
-	if err != nil || cookie.Value == "" {
-		return
+	manager.SessionDestroyWithID(r.Context(), sid)
+	// the destroyed session must not be written again by the middleware
+	if s := requestSessionFromContext(r.Context()); s != nil {
+		s.replace(nil)
 	}
+	manager.writeSid(w, r, "")
+}
 
-	sid, _ := url.QueryUnescape(cookie.Value)
-	manager.provider.SessionDestroy(nil, sid)
-	if manager.config.EnableSetCookie {
-		expiration := time.Now()
-		cookie = &http.Cookie{
-			Name:     manager.config.CookieName,
-			Path:     "/",
-			HttpOnly: !manager.config.DisableHTTPOnly,
-			Expires:  expiration,
-			MaxAge:   -1,
-			Domain:   manager.config.Domain,
-			SameSite: manager.config.CookieSameSite,
+// SessionDestroyWithID destroys the session sid, for transports other than
+// HTTP. Errors are returned and reported to the error hook.
+func (manager *Manager) SessionDestroyWithID(ctx context.Context, sid string) error {
+	err := manager.provider.SessionDestroy(ctx, sid)
+	if err != nil {
+		manager.reportError(ctx, sid, err)
+	}
+	if uerr := manager.unlockSession(sid); uerr != nil {
+		manager.reportError(ctx, sid, uerr)
+		if err == nil {
+			err = uerr
 		}
+	}
+	return err
+}
 
-		http.SetCookie(w, cookie)
+// SessionRelease saves the session to the provider. Errors are returned and
+// reported to the error hook, so that lost session writes are not missed by
+// handlers which defer the release. The cookie of sessions with their own
+// lifetime is renewed, see SetLifetime. Without a response, w may be nil and
+// the store gets a NopResponseWriter.
+func (manager *Manager) SessionRelease(ctx context.Context, w http.ResponseWriter, session Store) error {
+	if w != nil {
+		manager.writeLifetime(ctx, w, session)
+	} else {
+		w = NopResponseWriter{}
+	}
+	err := session.SessionRelease(ctx, w)
+	if err != nil {
+		manager.reportError(ctx, session.SessionID(ctx), err)
 	}
+	return err
+}
+
+// NopResponseWriter discards everything written to it. It's passed to stores
+// released without an HTTP response, e.g. for gRPC calls.
+type NopResponseWriter struct{}
+
+// Header returns a new header, which is discarded
+func (NopResponseWriter) Header() http.Header {
+	return make(http.Header)
 }
 
+// Write discards b
+func (NopResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// WriteHeader does nothing
+func (NopResponseWriter) WriteHeader(int) {}
+
 // GetSessionStore Get SessionStore by its id.
 func (manager *Manager) GetSessionStore(sid string) (sessions Store, err error) {
-	sessions, err = manager.provider.SessionRead(nil, sid)
+	sessions, err = manager.provider.SessionRead(context.Background(), sid)
 	return
 }
 
 // GC Start session gc process.
 // it can do gc in times after gc lifetime.
 func (manager *Manager) GC() {
-	manager.provider.SessionGC(nil)
-	time.AfterFunc(time.Duration(manager.config.Gclifetime)*time.Second, func() { manager.GC() })
+	manager.GCContext(context.Background())
+}
+
+// GCContext Start session gc process which stops once ctx is done.
+// ctx is passed to the provider on every gc run.
+func (manager *Manager) GCContext(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	if gc, ok := manager.provider.(GCWithError); ok {
+		if err := gc.SessionGCWithError(ctx); err != nil {
+			manager.reportError(ctx, "", err)
+		}
+	} else {
+		manager.provider.SessionGC(ctx)
+	}
+	time.AfterFunc(time.Duration(manager.config.Gclifetime)*time.Second, func() { manager.GCContext(ctx) })
 }
 
 // SessionRegenerateID Regenerate a session id for this SessionStore who's id is saving in http request.
+// The provider is accessed with the context of the request.
 func (manager *Manager) SessionRegenerateID(w http.ResponseWriter, r *http.Request) (Store, error) {
+	ctx := contextWithRequest(r)
 	sid, err := manager.sessionID()
 	if err != nil {
 		return nil, err
 	}
+	oldsid, err := manager.getSid(r)
+	if err != nil {
+		return nil, err
+	}
 
-	var session Store
+	session, err := manager.regenerate(ctx, oldsid, sid)
+	if err != nil {
+		return nil, err
+	}
+	manager.writeSid(w, r, sid)
+	if s := requestSessionFromContext(r.Context()); s != nil {
+		s.replace(session)
+	}
+
+	return session, nil
+}
+
+// SessionRegenerateWithID moves the session oldsid to a new ID, or starts a
+// new session if oldsid is empty, for transports other than HTTP.
+func (manager *Manager) SessionRegenerateWithID(ctx context.Context, oldsid string) (Store, error) {
+	sid, err := manager.sessionID()
+	if err != nil {
+		return nil, err
+	}
+	return manager.regenerate(ctx, oldsid, sid)
+}
+
+// SessionRegenerateToID moves the session oldsid to sid, an ID chosen by the
+// caller, like SessionRegenerateWithID. Only IDs of trusted clients should
+// be passed, others could fix the session IDs of users.
+func (manager *Manager) SessionRegenerateToID(ctx context.Context, oldsid, sid string) (Store, error) {
+	return manager.regenerate(ctx, oldsid, sid)
+}
 
-	cookie, err := r.Cookie(manager.config.CookieName)
-	if err != nil || cookie.Value == "" {
-		// delete old cookie
-		session, err = manager.provider.SessionRead(nil, sid)
+func (manager *Manager) regenerate(ctx context.Context, oldsid, sid string) (session Store, err error) {
+	if oldsid == "" {
+		session, err = manager.provider.SessionRead(ctx, sid)
+	} else {
+		session, err = manager.provider.SessionRegenerate(ctx, oldsid, sid)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if oldsid != "" {
+		// the new session ID is not known to other requests yet
+		if err = manager.unlockSession(oldsid); err != nil {
+			manager.reportError(ctx, oldsid, err)
+		}
+		revoked, err := manager.reindexUser(ctx, oldsid, session)
 		if err != nil {
-			return nil, err
+			manager.reportError(ctx, sid, err)
 		}
-		cookie = &http.Cookie{
-			Name:     manager.config.CookieName,
-			Value:    url.QueryEscape(sid),
-			Path:     "/",
-			HttpOnly: !manager.config.DisableHTTPOnly,
-			Secure:   manager.isSecure(r),
-			Domain:   manager.config.Domain,
-			SameSite: manager.config.CookieSameSite,
+		if !revoked {
+			return session, nil
 		}
-	} else {
-		oldsid, err := url.QueryUnescape(cookie.Value)
-		if err != nil {
+		// revoked sessions are replaced by a new session with the new ID
+		if err = manager.provider.SessionDestroy(ctx, sid); err != nil {
 			return nil, err
 		}
-
-		session, err = manager.provider.SessionRegenerate(nil, oldsid, sid)
-		if err != nil {
+		if session, err = manager.provider.SessionRead(ctx, sid); err != nil {
 			return nil, err
 		}
-
-		cookie.Value = url.QueryEscape(sid)
-		cookie.HttpOnly = true
-		cookie.Path = "/"
 	}
-	if manager.config.CookieLifeTime > 0 {
-		cookie.MaxAge = manager.config.CookieLifeTime
-		cookie.Expires = time.Now().Add(time.Duration(manager.config.CookieLifeTime) * time.Second)
-	}
-	if manager.config.EnableSetCookie {
-		http.SetCookie(w, cookie)
-	}
-	r.AddCookie(cookie)
-
-	if manager.config.EnableSidInHTTPHeader {
-		r.Header.Set(manager.config.SessionNameInHTTPHeader, sid)
-		w.Header().Set(manager.config.SessionNameInHTTPHeader, sid)
+	if err = manager.touch(ctx, session); err != nil {
+		return nil, err
 	}
-
 	return session, nil
 }
 
 // GetActiveSession Get all active sessions count number.
 func (manager *Manager) GetActiveSession() int {
-	return manager.provider.SessionAll(nil)
+	return manager.provider.SessionAll(context.Background())
+}
+
+// reportError passes err to the error hook, or logs it without one
+func (manager *Manager) reportError(ctx context.Context, sid string, err error) {
+	if manager.config.ErrorHook == nil {
+		SLogger.Println(err)
+		return
+	}
+	manager.config.ErrorHook(ctx, sid, err)
 }
 
 // SetSecure Set cookie with https.
@@ -349,6 +626,11 @@ func (manager *Manager) SetSecure(secure bool) {
 	manager.config.Secure = secure
 }
 
+// NewSessionID generates a new session id honouring the configured length and prefix.
+func (manager *Manager) NewSessionID() (string, error) {
+	return manager.sessionID()
+}
+
 func (manager *Manager) sessionID() (string, error) {
 	b := make([]byte, manager.config.SessionIDLength)
 	n, err := rand.Read(b)
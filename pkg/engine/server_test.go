@@ -21,9 +21,17 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"container/list"
+	"context"
 	"crypto/aes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test_gob(t *testing.T) {
@@ -65,6 +73,276 @@ func TestGenerate(t *testing.T) {
 	}
 }
 
+func TestRunWithContext(t *testing.T) {
+	errFn := errors.New("fn failed")
+	err := RunWithContext(context.Background(), func() error { return errFn })
+	if err != errFn {
+		t.Fatal("expected error of fn, got", err)
+	}
+	err = RunWithContext(nil, func() error { return errFn })
+	if err != errFn {
+		t.Fatal("expected error of fn with a nil context, got", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	err = RunWithContext(ctx, func() error { called = true; return nil })
+	if err != context.Canceled || called {
+		t.Fatal("expected fn not to run with a cancelled context, got", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	block := make(chan struct{})
+	defer close(block)
+	err = RunWithContext(ctx, func() error { <-block; return nil })
+	if err != context.DeadlineExceeded {
+		t.Fatal("expected deadline exceeded, got", err)
+	}
+}
+
+type ctxKey struct{}
+
+// ctxProvider records the contexts it is called with
+type ctxProvider struct {
+	MemProvider
+	contexts []context.Context
+}
+
+func (p *ctxProvider) SessionExist(ctx context.Context, sid string) (bool, error) {
+	p.contexts = append(p.contexts, ctx)
+	return p.MemProvider.SessionExist(ctx, sid)
+}
+
+func (p *ctxProvider) SessionRead(ctx context.Context, sid string) (Store, error) {
+	p.contexts = append(p.contexts, ctx)
+	return p.MemProvider.SessionRead(ctx, sid)
+}
+
+func (p *ctxProvider) SessionDestroy(ctx context.Context, sid string) error {
+	p.contexts = append(p.contexts, ctx)
+	return p.MemProvider.SessionDestroy(ctx, sid)
+}
+
+func TestManagerPassesRequestContext(t *testing.T) {
+	provider := &ctxProvider{MemProvider: MemProvider{list: list.New(), sessions: make(map[string]*list.Element)}}
+	Register("ctxtest", provider)
+	manager, err := NewManager("ctxtest", &ManagerConfig{CookieName: "bsessionid", EnableSetCookie: true, Gclifetime: 3600})
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	r, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+	w := httptest.NewRecorder()
+	if _, err = manager.SessionStart(w, r); err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	manager.SessionDestroy(w, r)
+
+	if len(provider.contexts) == 0 {
+		t.Fatal("provider was not called")
+	}
+	for _, c := range provider.contexts {
+		if c.Value(ctxKey{}) != "request" {
+			t.Fatal("provider was not called with the request context")
+		}
+	}
+}
+
+// failingStore fails to save the session
+type failingStore struct {
+	Store
+}
+
+var errRelease = errors.New("release failed")
+
+func (st *failingStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	return errRelease
+}
+
+func TestManagerSessionReleaseReportsErrors(t *testing.T) {
+	var reported []error
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgErrorHook(func(ctx context.Context, sid string, err error) {
+			if sid == "" {
+				t.Error("error reported without session id")
+			}
+			reported = append(reported, err)
+		}),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, err := manager.SessionStart(w, r)
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	if err = manager.SessionRelease(r.Context(), w, sess); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	if len(reported) != 0 {
+		t.Fatal("unexpected errors reported:", reported)
+	}
+
+	err = manager.SessionRelease(r.Context(), w, &failingStore{sess})
+	if err != errRelease {
+		t.Fatal("expected release error, got", err)
+	}
+	if len(reported) != 1 || reported[0] != errRelease {
+		t.Fatal("expected release error to be reported, got", reported)
+	}
+}
+
+// v1Store implements version 1 of the store API
+type v1Store struct {
+	sid    string
+	values map[interface{}]interface{}
+}
+
+func (st *v1Store) Set(ctx context.Context, key, value interface{}) error {
+	st.values[key] = value
+	return nil
+}
+
+func (st *v1Store) Get(ctx context.Context, key interface{}) interface{} {
+	return st.values[key]
+}
+
+func (st *v1Store) Delete(ctx context.Context, key interface{}) error {
+	delete(st.values, key)
+	return nil
+}
+
+func (st *v1Store) SessionID(ctx context.Context) string {
+	return st.sid
+}
+
+func (st *v1Store) SessionRelease(ctx context.Context, w http.ResponseWriter) {}
+
+func (st *v1Store) Flush(ctx context.Context) error {
+	st.values = make(map[interface{}]interface{})
+	return nil
+}
+
+func TestAdaptStoreV1(t *testing.T) {
+	st := AdaptStoreV1(&v1Store{values: make(map[interface{}]interface{})})
+	if err := st.Set(nil, "username", "bhojpur"); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := st.Get(nil, "username"); err != nil || v != "bhojpur" {
+		t.Fatal("get username failed:", v, err)
+	}
+	if err := st.SessionRelease(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := st.(ValueLister); ok {
+		t.Fatal("adapted store must not list values the original store cannot list")
+	}
+}
+
+// v1Provider implements ProviderV1 with v1Stores
+type v1Provider struct {
+	stores map[string]*v1Store
+}
+
+func (p *v1Provider) SessionInit(ctx context.Context, gclifetime int64, config string) error {
+	p.stores = make(map[string]*v1Store)
+	return nil
+}
+
+func (p *v1Provider) SessionRead(ctx context.Context, sid string) (StoreV1, error) {
+	if st, ok := p.stores[sid]; ok {
+		return st, nil
+	}
+	st := &v1Store{sid: sid, values: make(map[interface{}]interface{})}
+	p.stores[sid] = st
+	return st, nil
+}
+
+func (p *v1Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
+	_, ok := p.stores[sid]
+	return ok, nil
+}
+
+func (p *v1Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (StoreV1, error) {
+	st, _ := p.SessionRead(ctx, oldsid)
+	delete(p.stores, oldsid)
+	st.(*v1Store).sid = sid
+	p.stores[sid] = st.(*v1Store)
+	return st, nil
+}
+
+func (p *v1Provider) SessionDestroy(ctx context.Context, sid string) error {
+	delete(p.stores, sid)
+	return nil
+}
+
+func (p *v1Provider) SessionAll(ctx context.Context) int {
+	return len(p.stores)
+}
+
+func (p *v1Provider) SessionGC(ctx context.Context) {}
+
+func TestAdaptProviderV1(t *testing.T) {
+	p := AdaptProviderV1(&v1Provider{})
+	if err := p.SessionInit(nil, 3600, ""); err != nil {
+		t.Fatal(err)
+	}
+	st, err := p.SessionRead(nil, "sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Set(nil, "username", "bhojpur")
+	if err := st.SessionRelease(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	st, err = p.SessionRegenerate(nil, "sid", "newsid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := st.Get(nil, "username"); err != nil || v != "bhojpur" || st.SessionID(nil) != "newsid" {
+		t.Fatal("regenerated session lost its values:", v, err)
+	}
+	if ok, _ := p.SessionExist(nil, "sid"); ok || p.SessionAll(nil) != 1 {
+		t.Fatal("old session still exists")
+	}
+}
+
+var errGC = errors.New("gc failed")
+
+// gcErrProvider fails every garbage collection
+type gcErrProvider struct {
+	MemProvider
+}
+
+func (p *gcErrProvider) SessionGCWithError(ctx context.Context) error {
+	return errGC
+}
+
+func TestGCWithError(t *testing.T) {
+	Register("gcerr", &gcErrProvider{})
+	reported := make(chan error, 1)
+	conf := NewManagerConfig(CfgMaxLifeTime(3600), CfgGcLifeTime(3600),
+		CfgErrorHook(func(ctx context.Context, sid string, err error) { reported <- err }))
+	manager, err := NewManager("gcerr", conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager.GCContext(ctx)
+	if err := <-reported; err != errGC {
+		t.Fatal("expected the gc error to be reported, got", err)
+	}
+}
+
 func TestCookieEncodeDecode(t *testing.T) {
 	hashKey := "testhashKey"
 	blockkey := generateRandomKey(16)
@@ -76,11 +354,11 @@ func TestCookieEncodeDecode(t *testing.T) {
 	val := make(map[interface{}]interface{})
 	val["name"] = "bhojpur"
 	val["gender"] = "male"
-	str, err := encodeCookie(block, hashKey, securityName, val)
+	str, err := encodeCookie(block, hashKey, securityName, GobSerializer{}, val)
 	if err != nil {
 		t.Fatal("encodeCookie:", err)
 	}
-	dst, err := decodeCookie(block, hashKey, securityName, str, 3600)
+	dst, err := decodeCookie(block, hashKey, securityName, GobSerializer{}, str, 3600)
 	if err != nil {
 		t.Fatal("decodeCookie", err)
 	}
@@ -92,6 +370,48 @@ func TestCookieEncodeDecode(t *testing.T) {
 	}
 }
 
+func TestCookieEncodeDecodeAEAD(t *testing.T) {
+	aead, err := newCookieAEAD("testhashKey")
+	if err != nil {
+		t.Fatal("newCookieAEAD:", err)
+	}
+	val := map[interface{}]interface{}{"name": "bhojpur"}
+	str, err := encodeCookieAEAD(aead, "bsessionid", GobSerializer{}, val)
+	if err != nil {
+		t.Fatal("encodeCookieAEAD:", err)
+	}
+	if !strings.HasPrefix(str, aeadCookiePrefix) {
+		t.Fatal("expected versioned cookie, got", str)
+	}
+
+	// a key derived from the same secret, e.g. after a restart, opens the cookie
+	aead2, _ := newCookieAEAD("testhashKey")
+	dst, err := decodeCookieAEAD(aead2, "bsessionid", GobSerializer{}, str, 3600)
+	if err != nil {
+		t.Fatal("decodeCookieAEAD", err)
+	}
+	if dst["name"] != "bhojpur" {
+		t.Fatal("dst get map error")
+	}
+
+	if _, err = decodeCookieAEAD(aead, "othername", GobSerializer{}, str, 3600); err == nil {
+		t.Fatal("expected error for cookie of another name")
+	}
+	other, _ := newCookieAEAD("otherhashKey")
+	if _, err = decodeCookieAEAD(other, "bsessionid", GobSerializer{}, str, 3600); err == nil {
+		t.Fatal("expected error for cookie sealed with another key")
+	}
+	b, _ := base64.RawURLEncoding.DecodeString(str[len(aeadCookiePrefix):])
+	b[len(b)-1] ^= 1
+	tampered := aeadCookiePrefix + base64.RawURLEncoding.EncodeToString(b)
+	if _, err = decodeCookieAEAD(aead, "bsessionid", GobSerializer{}, tampered, 3600); err == nil {
+		t.Fatal("expected error for tampered cookie")
+	}
+	if _, err = newCookieAEAD(""); err == nil {
+		t.Fatal("expected error for empty key")
+	}
+}
+
 func TestParseConfig(t *testing.T) {
 	s := `{"cookieName":"bsessionid","gclifetime":3600}`
 	cf := new(ManagerConfig)
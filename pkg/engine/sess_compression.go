@@ -0,0 +1,244 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressionHeader starts every compressed payload, followed by the ID of
+// the compressor. None of the built-in serializers start a payload with it,
+// so compressed and uncompressed payloads can be stored side by side.
+const compressionHeader = 0x00
+
+// DefaultMaxDecompressedSize is the size in bytes up to which compressed
+// payloads are decompressed, unless CompressSerializer is given another one
+const DefaultMaxDecompressedSize = 4 << 20
+
+// ErrPayloadTooLarge is returned when a compressed payload expands to more
+// than the maximum size, e.g. a payload crafted to exhaust memory
+var ErrPayloadTooLarge = errors.New("session: decompressed payload exceeds the size limit")
+
+// Compressor compresses serialized session values
+type Compressor interface {
+	// ID identifies the compressor in the header of compressed payloads.
+	// IDs below 16 are reserved for the built-in compressors.
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	// Decompress returns ErrPayloadTooLarge if data expands to more than
+	// max bytes
+	Decompress(data []byte, max int64) ([]byte, error)
+}
+
+var (
+	compressors   = map[string]Compressor{}
+	compressorIDs = map[byte]Compressor{}
+)
+
+func init() {
+	RegisterCompressor("gzip", GzipCompressor{})
+	RegisterCompressor("zstd", ZstdCompressor{})
+	RegisterCompressor("snappy", SnappyCompressor{})
+}
+
+// RegisterCompressor makes a compressor available by the provided name.
+// If compressor is nil or its ID is already registered, it panic
+func RegisterCompressor(name string, compressor Compressor) {
+	if compressor == nil {
+		panic("session: RegisterCompressor compressor is nil")
+	}
+	if _, dup := compressorIDs[compressor.ID()]; dup {
+		panic(fmt.Sprintf("session: RegisterCompressor called twice for id %d", compressor.ID()))
+	}
+	compressors[name] = compressor
+	compressorIDs[compressor.ID()] = compressor
+}
+
+// GetCompressor return the compressor registered with name
+func GetCompressor(name string) (Compressor, error) {
+	compressor, ok := compressors[name]
+	if !ok {
+		return nil, fmt.Errorf("session: unknown compression %q", name)
+	}
+	return compressor, nil
+}
+
+// CompressSerializer returns a serializer which compresses the payloads of
+// serializer with compressor. It reads compressed payloads of any registered
+// compressor as well as uncompressed payloads. A nil compressor writes
+// uncompressed payloads. Payloads are decompressed up to maxSize bytes, or
+// DefaultMaxDecompressedSize if maxSize is not positive.
+func CompressSerializer(serializer Serializer, compressor Compressor, maxSize int64) Serializer {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	return &compressSerializer{serializer: serializer, compressor: compressor, maxSize: maxSize}
+}
+
+type compressSerializer struct {
+	serializer Serializer
+	compressor Compressor
+	maxSize    int64
+}
+
+func (s *compressSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	b, err := s.serializer.Serialize(values)
+	if err != nil || s.compressor == nil {
+		return b, err
+	}
+	compressed, err := s.compressor.Compress(b)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{compressionHeader, s.compressor.ID()}, compressed...), nil
+}
+
+func (s *compressSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	if len(data) >= 2 && data[0] == compressionHeader {
+		compressor, ok := compressorIDs[data[1]]
+		if !ok {
+			return nil, fmt.Errorf("session: unknown compression id %d", data[1])
+		}
+		var err error
+		if data, err = compressor.Decompress(data[2:], s.maxSize); err != nil {
+			return nil, err
+		}
+	}
+	return s.serializer.Deserialize(data)
+}
+
+// readLimited reads r up to max bytes
+func readLimited(r io.Reader, max int64) ([]byte, error) {
+	b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(b)) > max {
+		return nil, ErrPayloadTooLarge
+	}
+	return b, nil
+}
+
+// GzipCompressor compresses with gzip
+type GzipCompressor struct{}
+
+// ID of gzip
+func (GzipCompressor) ID() byte {
+	return 1
+}
+
+// Compress data with gzip
+func (GzipCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress gzip data
+func (GzipCompressor) Decompress(data []byte, max int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readLimited(r, max)
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+func zstdCodec() (*zstd.Encoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdErr
+}
+
+// ZstdCompressor compresses with zstd
+type ZstdCompressor struct{}
+
+// ID of zstd
+func (ZstdCompressor) ID() byte {
+	return 2
+}
+
+// Compress data with zstd
+func (ZstdCompressor) Compress(data []byte) ([]byte, error) {
+	encoder, err := zstdCodec()
+	if err != nil {
+		return nil, err
+	}
+	return encoder.EncodeAll(data, nil), nil
+}
+
+// Decompress zstd data
+func (ZstdCompressor) Decompress(data []byte, max int64) ([]byte, error) {
+	decoder, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	return readLimited(decoder, max)
+}
+
+// SnappyCompressor compresses with the snappy block format
+type SnappyCompressor struct{}
+
+// ID of snappy
+func (SnappyCompressor) ID() byte {
+	return 3
+}
+
+// Compress data with snappy
+func (SnappyCompressor) Compress(data []byte) ([]byte, error) {
+	return snappy.Encode(nil, data), nil
+}
+
+// Decompress snappy data
+func (SnappyCompressor) Decompress(data []byte, max int64) ([]byte, error) {
+	// blocks start with their decoded length
+	n, err := snappy.DecodedLen(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(n) > max {
+		return nil, ErrPayloadTooLarge
+	}
+	return snappy.Decode(nil, data)
+}
@@ -0,0 +1,87 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompressSerializer(t *testing.T) {
+	values := map[interface{}]interface{}{"cart": strings.Repeat("item,", 200)}
+	plain, err := GobSerializer{}.Serialize(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reads uncompressed payloads and compressed payloads of any compressor
+	reader := CompressSerializer(GobSerializer{}, nil, 0)
+
+	for _, name := range []string{"gzip", "zstd", "snappy"} {
+		compressor, err := GetCompressor(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serializer := CompressSerializer(GobSerializer{}, compressor, 0)
+		b, err := serializer.Serialize(values)
+		if err != nil {
+			t.Fatalf("%s: serialize failed: %v", name, err)
+		}
+		if b[0] != compressionHeader || b[1] != compressor.ID() {
+			t.Fatalf("%s: missing compression header", name)
+		}
+		if len(b) >= len(plain) {
+			t.Errorf("%s: expected %d bytes to be compressed, got %d", name, len(plain), len(b))
+		}
+		for _, s := range []Serializer{serializer, reader} {
+			dst, err := s.Deserialize(b)
+			if err != nil {
+				t.Fatalf("%s: deserialize failed: %v", name, err)
+			}
+			if dst["cart"] != values["cart"] {
+				t.Fatalf("%s: unexpected values %v", name, dst)
+			}
+		}
+		// payloads which expand beyond the limit are rejected
+		if _, err = CompressSerializer(GobSerializer{}, nil, int64(len(plain)-1)).Deserialize(b); err != ErrPayloadTooLarge {
+			t.Fatalf("%s: expected ErrPayloadTooLarge, got %v", name, err)
+		}
+		if _, err = CompressSerializer(GobSerializer{}, nil, int64(len(plain))).Deserialize(b); err != nil {
+			t.Fatalf("%s: deserialize at the limit failed: %v", name, err)
+		}
+		dst, err := serializer.Deserialize(plain)
+		if err != nil {
+			t.Fatalf("%s: deserialize of uncompressed payload failed: %v", name, err)
+		}
+		if dst["cart"] != values["cart"] {
+			t.Fatalf("%s: unexpected values %v", name, dst)
+		}
+	}
+
+	if _, err = reader.Deserialize([]byte{compressionHeader, 0xff, 1, 2}); err == nil {
+		t.Error("expected error for unknown compression id")
+	}
+	if _, err = GetCompressor("xz"); err == nil {
+		t.Error("expected error for unknown compression")
+	}
+	if _, err = NewManager("memory", NewManagerConfig(CfgCompression("xz"))); err == nil {
+		t.Error("expected manager error for unknown compression")
+	}
+}
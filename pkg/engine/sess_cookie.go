@@ -25,17 +25,34 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 )
 
 var cookiepder = &CookieProvider{}
 
+// ErrCookieTooLarge is returned by SessionRelease of the cookie provider when
+// the encoded session exceeds the configured maxSize
+var ErrCookieTooLarge = errors.New("session: cookie session exceeds the size limit")
+
+// chunkedCookiePrefix marks a session cookie whose value is split across
+// the cookies <cookieName>_1 to <cookieName>_N. The count follows the prefix.
+const chunkedCookiePrefix = "chunked."
+
+// defaultCookieChunkSize keeps each cookie, with its name and attributes,
+// below the limit of 4096 bytes of browsers
+const defaultCookieChunkSize = 3800
+
 // CookieSessionStore Cookie SessionStore
 type CookieSessionStore struct {
 	sid    string
 	values map[interface{}]interface{} // session data
+	chunks int                         // chunk cookies sent with the request
 	lock   sync.RWMutex
 }
 
@@ -49,13 +66,24 @@ func (st *CookieSessionStore) Set(ctx context.Context, key, value interface{}) e
 }
 
 // Get value from cookie session
-func (st *CookieSessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (st *CookieSessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	st.lock.RLock()
 	defer st.lock.RUnlock()
 	if v, ok := st.values[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in cookie session
+func (st *CookieSessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.values))
+	for k, v := range st.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete value in cookie session
@@ -79,80 +107,262 @@ func (st *CookieSessionStore) SessionID(context.Context) string {
 	return st.sid
 }
 
-// SessionRelease Write cookie session to http response cookie
-func (st *CookieSessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
+// SessionRelease Write cookie session to http response cookie.
+// Sessions larger than chunkSize are split across several cookies
+// and chunk cookies which are no longer used are removed.
+func (st *CookieSessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
 	st.lock.Lock()
-	encodedCookie, err := encodeCookie(cookiepder.block, cookiepder.config.SecurityKey, cookiepder.config.SecurityName, st.values)
-	st.lock.Unlock()
-	if err == nil {
-		cookie := &http.Cookie{Name: cookiepder.config.CookieName,
-			Value:    url.QueryEscape(encodedCookie),
-			Path:     "/",
-			HttpOnly: true,
-			Secure:   cookiepder.config.Secure,
-			MaxAge:   cookiepder.config.Maxage}
+	defer st.lock.Unlock()
+	encodedCookie, err := cookiepder.encode(st.values)
+	if err != nil {
+		return err
+	}
+	if cookiepder.config.MaxSize > 0 && len(encodedCookie) > cookiepder.config.MaxSize {
+		return fmt.Errorf("%w: %d bytes, limit is %d", ErrCookieTooLarge, len(encodedCookie), cookiepder.config.MaxSize)
+	}
+
+	// sessions with their own lifetime keep their cookies for it
+	maxAge := cookiepder.config.Maxage
+	if lifetime := ValuesLifetime(st.values, 0); lifetime > 0 {
+		maxAge = int(lifetime)
+	}
+	setCookie := func(name, value string) {
+		cookie := cookiepder.cookie(name, value)
+		cookie.MaxAge = maxAge
 		http.SetCookie(w, cookie)
 	}
+	chunks := cookiepder.split(encodedCookie)
+	if len(chunks) == 1 {
+		setCookie(cookiepder.config.CookieName, chunks[0])
+		chunks = nil
+	} else {
+		setCookie(cookiepder.config.CookieName, chunkedCookiePrefix+strconv.Itoa(len(chunks)))
+		for i, chunk := range chunks {
+			setCookie(cookiepder.chunkName(i+1), chunk)
+		}
+	}
+	for i := len(chunks) + 1; i <= st.chunks; i++ {
+		stale := cookiepder.cookie(cookiepder.chunkName(i), "")
+		stale.MaxAge = -1
+		http.SetCookie(w, stale)
+	}
+	st.chunks = len(chunks)
+	return nil
 }
 
 type cookieConfig struct {
-	SecurityKey  string `json:"securityKey"`
-	BlockKey     string `json:"blockKey"`
-	SecurityName string `json:"securityName"`
-	CookieName   string `json:"cookieName"`
-	Secure       bool   `json:"secure"`
-	Maxage       int    `json:"maxage"`
+	SecurityKey  string   `json:"securityKey"`
+	SecurityKeys []string `json:"securityKeys"`
+	BlockKey     string   `json:"blockKey"`
+	BlockKeys    []string `json:"blockKeys"`
+	SecurityName string   `json:"securityName"`
+	CookieName   string   `json:"cookieName"`
+	Secure       bool     `json:"secure"`
+	Maxage       int      `json:"maxage"`
+	Mode         string   `json:"mode"`
+	ChunkSize    int      `json:"chunkSize"`
+	MaxSize      int      `json:"maxSize"`
+}
+
+const (
+	// CookieModeLegacy encrypts cookies with AES-CTR and signs them with HMAC-SHA256
+	CookieModeLegacy = "legacy"
+	// CookieModeAEAD seals cookies with AES-GCM using a key derived from securityKey
+	CookieModeAEAD = "aead"
+)
+
+// cookieKey is one entry of the keyring of the cookie provider
+type cookieKey struct {
+	hashKey string
+	block   cipher.Block
+	aead    cipher.AEAD
 }
 
 // CookieProvider Cookie session provider
 type CookieProvider struct {
+	ProviderSerializer
+
 	maxlifetime int64
 	config      *cookieConfig
-	block       cipher.Block
+	// keys is the keyring, newest first. New cookies use keys[0].
+	keys []cookieKey
 }
 
 // SessionInit Init cookie session provider with max lifetime and config json.
 // maxlifetime is ignored.
 // json config:
 // 	securityKey - hash string
+// 	securityKeys - keyring of hash strings, newest first. it overrides securityKey.
 // 	blockKey - gob encode hash string. it's saved as aes crypto.
+// 	blockKeys - keyring of block keys, paired with securityKeys by position.
 // 	securityName - recognized name in encoded cookie string
 // 	cookieName - cookie name
 // 	maxage - cookie max life time.
+// 	mode - legacy (default) or aead. aead cookies only need securityKey,
+// 	cookies of the legacy format are still read in aead mode.
+// 	chunkSize - max length of one cookie value, larger sessions are split
+// 	across several cookies. default is 3800.
+// 	maxSize - max length of the encoded session, 0 means no limit.
+//
+// New cookies are written with the newest key, cookies written with a retired
+// key are still read until they expire and are re-written with the newest key
+// by SessionRelease.
 func (pder *CookieProvider) SessionInit(ctx context.Context, maxlifetime int64, config string) error {
 	pder.config = &cookieConfig{}
 	err := json.Unmarshal([]byte(config), pder.config)
 	if err != nil {
 		return err
 	}
-	if pder.config.BlockKey == "" {
-		pder.config.BlockKey = string(generateRandomKey(16))
+	aead := false
+	switch pder.config.Mode {
+	case "", CookieModeLegacy:
+	case CookieModeAEAD:
+		aead = true
+	default:
+		return fmt.Errorf("session: unknown cookie mode %q", pder.config.Mode)
+	}
+
+	securityKeys := pder.config.SecurityKeys
+	if len(securityKeys) == 0 {
+		securityKeys = []string{pder.config.SecurityKey}
+	}
+	blockKeys := pder.config.BlockKeys
+	if len(blockKeys) == 0 {
+		if pder.config.BlockKey == "" {
+			pder.config.BlockKey = string(generateRandomKey(16))
+		}
+		blockKeys = []string{pder.config.BlockKey}
+	}
+	if len(blockKeys) != 1 && len(blockKeys) != len(securityKeys) {
+		return errors.New("session: blockKeys must have one key for each of securityKeys")
 	}
 	if pder.config.SecurityName == "" {
 		pder.config.SecurityName = string(generateRandomKey(20))
 	}
-	pder.block, err = aes.NewCipher([]byte(pder.config.BlockKey))
-	if err != nil {
-		return err
+
+	keys := make([]cookieKey, len(securityKeys))
+	for i, securityKey := range securityKeys {
+		blockKey := blockKeys[0]
+		if len(blockKeys) > 1 {
+			blockKey = blockKeys[i]
+		}
+		keys[i].hashKey = securityKey
+		if keys[i].block, err = aes.NewCipher([]byte(blockKey)); err != nil {
+			return err
+		}
+		if aead {
+			if keys[i].aead, err = newCookieAEAD(securityKey); err != nil {
+				return err
+			}
+		}
+	}
+	if pder.config.ChunkSize <= 0 {
+		pder.config.ChunkSize = defaultCookieChunkSize
 	}
+	pder.keys = keys
 	pder.maxlifetime = maxlifetime
 	return nil
 }
 
 // SessionRead Get SessionStore in cooke.
 // decode cooke string to map and put into SessionStore with sid.
+// The chunks of a session split across several cookies are read from the
+// request of ctx.
 func (pder *CookieProvider) SessionRead(ctx context.Context, sid string) (Store, error) {
-	maps, _ := decodeCookie(pder.block,
-		pder.config.SecurityKey,
-		pder.config.SecurityName,
-		sid, pder.maxlifetime)
+	value := sid
+	chunks := 0
+	if r := RequestFromContext(ctx); r != nil {
+		value, chunks = pder.join(r, sid)
+	}
+	maps, _ := pder.decode(value)
 	if maps == nil {
 		maps = make(map[interface{}]interface{})
 	}
-	rs := &CookieSessionStore{sid: sid, values: maps}
+	rs := &CookieSessionStore{sid: sid, values: maps, chunks: chunks}
 	return rs, nil
 }
 
+// join returns the value of a chunked session cookie and the number of chunk
+// cookies in r, which includes stale chunks of an earlier session
+func (pder *CookieProvider) join(r *http.Request, sid string) (string, int) {
+	chunks := 0
+	for ; ; chunks++ {
+		if _, err := r.Cookie(pder.chunkName(chunks + 1)); err != nil {
+			break
+		}
+	}
+	if !strings.HasPrefix(sid, chunkedCookiePrefix) {
+		return sid, chunks
+	}
+	n, err := strconv.Atoi(sid[len(chunkedCookiePrefix):])
+	if err != nil || n > chunks {
+		return "", chunks
+	}
+	var value strings.Builder
+	for i := 1; i <= n; i++ {
+		cookie, _ := r.Cookie(pder.chunkName(i))
+		chunk, err := url.QueryUnescape(cookie.Value)
+		if err != nil {
+			return "", chunks
+		}
+		value.WriteString(chunk)
+	}
+	return value.String(), chunks
+}
+
+// split value into chunks of at most chunkSize bytes
+func (pder *CookieProvider) split(value string) []string {
+	size := pder.config.ChunkSize
+	if len(value) <= size {
+		return []string{value}
+	}
+	chunks := make([]string, 0, (len(value)+size-1)/size)
+	for len(value) > size {
+		chunks = append(chunks, value[:size])
+		value = value[size:]
+	}
+	return append(chunks, value)
+}
+
+func (pder *CookieProvider) chunkName(i int) string {
+	return pder.config.CookieName + "_" + strconv.Itoa(i)
+}
+
+func (pder *CookieProvider) cookie(name, value string) *http.Cookie {
+	return &http.Cookie{Name: name,
+		Value:    url.QueryEscape(value),
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   pder.config.Secure,
+		MaxAge:   pder.config.Maxage}
+}
+
+// encode values with the newest key and the configured cookie mode
+func (pder *CookieProvider) encode(values map[interface{}]interface{}) (string, error) {
+	key := pder.keys[0]
+	if key.aead != nil {
+		return encodeCookieAEAD(key.aead, pder.config.CookieName, pder.Serializer(), values)
+	}
+	return encodeCookie(key.block, key.hashKey, pder.config.SecurityName, pder.Serializer(), values)
+}
+
+// decode a cookie of either format with the first key of the keyring which opens it
+func (pder *CookieProvider) decode(value string) (map[interface{}]interface{}, error) {
+	var err error
+	for _, key := range pder.keys {
+		var maps map[interface{}]interface{}
+		if key.aead != nil && strings.HasPrefix(value, aeadCookiePrefix) {
+			maps, err = decodeCookieAEAD(key.aead, pder.config.CookieName, pder.Serializer(), value, pder.maxlifetime)
+		} else {
+			maps, err = decodeCookie(key.block, key.hashKey, pder.config.SecurityName, pder.Serializer(), value, pder.maxlifetime)
+		}
+		if err == nil {
+			return maps, nil
+		}
+	}
+	return nil, err
+}
+
 // SessionExist Cookie session is always existed
 func (pder *CookieProvider) SessionExist(ctx context.Context, sid string) (bool, error) {
 	return true, nil
@@ -22,8 +22,10 @@ package engine
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -48,10 +50,12 @@ func TestCookie(t *testing.T) {
 	if err != nil {
 		t.Fatal("set error,", err)
 	}
-	if username := sess.Get(nil, "username"); username != "bhojpur" {
+	if username, _ := sess.Get(nil, "username"); username != "bhojpur" {
 		t.Fatal("get username error")
 	}
-	sess.SessionRelease(nil, w)
+	if err = sess.SessionRelease(nil, w); err != nil {
+		t.Fatal("release failed:", err)
+	}
 	if cookiestr := w.Header().Get("Set-Cookie"); cookiestr == "" {
 		t.Fatal("setcookie error")
 	} else {
@@ -109,3 +113,178 @@ func TestDestorySessionCookie(t *testing.T) {
 		t.Fatal("after destroy session and reqeust again ,get cookie session id is same.")
 	}
 }
+
+func TestCookieAEAD(t *testing.T) {
+	newManager := func() *Manager {
+		manager, err := NewManager("cookie", NewManagerConfig(
+			CfgCookieName("bsessionid"),
+			CfgGcLifeTime(3600),
+			CfgProviderConfig(`{"cookieName":"bsessionid","securityKey":"bhojpurcookiehashkey","mode":"aead"}`),
+		))
+		if err != nil {
+			t.Fatal("init cookie session err", err)
+		}
+		return manager
+	}
+	defer cookiepder.SessionInit(nil, 3600, `{"cookieName":"bsessionid","securityKey":"bhojpurcookiehashkey"}`)
+
+	globalSessions := newManager()
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, err := globalSessions.SessionStart(w, r)
+	if err != nil {
+		t.Fatal("session start err,", err)
+	}
+	sess.Set(nil, "username", "bhojpur")
+	if err = sess.SessionRelease(nil, w); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	cookie := w.Result().Cookies()[0]
+	if !strings.HasPrefix(cookie.Value, aeadCookiePrefix) {
+		t.Fatal("expected aead cookie, got", cookie.Value)
+	}
+
+	// the cookie can be read after the provider is initialised again
+	globalSessions = newManager()
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	sess, err = globalSessions.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal("session start err,", err)
+	}
+	if username, _ := sess.Get(nil, "username"); username != "bhojpur" {
+		t.Fatal("get username error", username)
+	}
+
+	// cookies of the legacy format are still read
+	legacy, err := encodeCookie(cookiepder.keys[0].block, cookiepder.keys[0].hashKey, cookiepder.config.SecurityName,
+		GobSerializer{}, map[interface{}]interface{}{"username": "legacy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess, _ = cookiepder.SessionRead(nil, legacy)
+	if username, _ := sess.Get(nil, "username"); username != "legacy" {
+		t.Fatal("get legacy username error", username)
+	}
+
+	if err = cookiepder.SessionInit(nil, 3600, `{"mode":"aead"}`); err == nil {
+		t.Fatal("expected error for aead mode without securityKey")
+	}
+}
+
+func TestCookieKeyRotation(t *testing.T) {
+	defer cookiepder.SessionInit(nil, 3600, `{"cookieName":"bsessionid","securityKey":"bhojpurcookiehashkey"}`)
+
+	for _, mode := range []string{CookieModeLegacy, CookieModeAEAD} {
+		initKeys := func(securityKeys, blockKeys string) {
+			config := `{"cookieName":"bsessionid","securityName":"bhojpur","mode":"` + mode + `",` +
+				`"securityKeys":` + securityKeys + `,"blockKeys":` + blockKeys + `}`
+			if err := cookiepder.SessionInit(nil, 3600, config); err != nil {
+				t.Fatal(mode, "init cookie session err", err)
+			}
+		}
+
+		initKeys(`["oldhashkey"]`, `["oldblockkey12345"]`)
+		oldCookie, err := cookiepder.encode(map[interface{}]interface{}{"username": "bhojpur"})
+		if err != nil {
+			t.Fatal(mode, err)
+		}
+
+		// the new key signs cookies, the retired key still reads them
+		initKeys(`["newhashkey","oldhashkey"]`, `["newblockkey12345","oldblockkey12345"]`)
+		sess, _ := cookiepder.SessionRead(nil, oldCookie)
+		if username, _ := sess.Get(nil, "username"); username != "bhojpur" {
+			t.Fatal(mode, "cookie of retired key not read", username)
+		}
+		w := httptest.NewRecorder()
+		if err = sess.SessionRelease(nil, w); err != nil {
+			t.Fatal(mode, "release failed:", err)
+		}
+		newCookie, _ := url.QueryUnescape(w.Result().Cookies()[0].Value)
+
+		// after the retired key is removed only the re-signed cookie is valid
+		initKeys(`["newhashkey"]`, `["newblockkey12345"]`)
+		if _, err = cookiepder.decode(oldCookie); err == nil {
+			t.Fatal(mode, "expected error for cookie of removed key")
+		}
+		sess, _ = cookiepder.SessionRead(nil, newCookie)
+		if username, _ := sess.Get(nil, "username"); username != "bhojpur" {
+			t.Fatal(mode, "re-signed cookie not read", username)
+		}
+	}
+
+	err := cookiepder.SessionInit(nil, 3600, `{"securityKeys":["a","b"],"blockKeys":["k1k1k1k1k1k1k1k1","k2k2k2k2k2k2k2k2","k3k3k3k3k3k3k3k3"]}`)
+	if err == nil {
+		t.Fatal("expected error for mismatched keyrings")
+	}
+}
+
+func TestCookieChunks(t *testing.T) {
+	globalSessions, err := NewManager("cookie", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgProviderConfig(`{"cookieName":"bsessionid","securityKey":"bhojpurcookiehashkey","mode":"aead","chunkSize":100,"maxSize":2000}`),
+	))
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+	defer cookiepder.SessionInit(nil, 3600, `{"cookieName":"bsessionid","securityKey":"bhojpurcookiehashkey"}`)
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, err := globalSessions.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal("session start err,", err)
+	}
+	cart := strings.Repeat("item,", 100)
+	sess.Set(nil, "cart", cart)
+	w := httptest.NewRecorder()
+	if err = sess.SessionRelease(nil, w); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) < 3 || !strings.HasPrefix(cookies[0].Value, chunkedCookiePrefix) {
+		t.Fatal("expected chunked cookies, got", len(cookies))
+	}
+	for _, cookie := range cookies {
+		if len(cookie.Value) > 100 {
+			t.Fatal("chunk exceeds chunk size:", len(cookie.Value))
+		}
+	}
+
+	// the chunks are joined on the next request
+	r, _ = http.NewRequest("GET", "/", nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	sess, err = globalSessions.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal("session start err,", err)
+	}
+	if v, _ := sess.Get(nil, "cart"); v != cart {
+		t.Fatal("chunked session not read", v)
+	}
+
+	// a smaller session removes the chunk cookies
+	sess.Delete(nil, "cart")
+	w = httptest.NewRecorder()
+	if err = sess.SessionRelease(nil, w); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	released := w.Result().Cookies()
+	if len(released) != len(cookies) {
+		t.Fatal("expected stale chunks to be removed, got", len(released))
+	}
+	if strings.HasPrefix(released[0].Value, chunkedCookiePrefix) {
+		t.Fatal("expected a single cookie")
+	}
+	for _, cookie := range released[1:] {
+		if cookie.MaxAge >= 0 {
+			t.Fatal("stale chunk not removed:", cookie.Name)
+		}
+	}
+
+	sess.Set(nil, "cart", strings.Repeat(cart, 10))
+	if err = sess.SessionRelease(nil, httptest.NewRecorder()); !errors.Is(err, ErrCookieTooLarge) {
+		t.Fatal("expected ErrCookieTooLarge, got", err)
+	}
+}
@@ -0,0 +1,127 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// encryptedPayloadID follows compressionHeader in encrypted payloads. It is
+// one of the IDs reserved for built-in compressors.
+const encryptedPayloadID = 0x0f
+
+// EncryptionKey is one key of the keyring which encrypts stored sessions.
+// ID is stored in every payload encrypted with the key.
+type EncryptionKey struct {
+	ID  string `json:"id"`
+	Key string `json:"key"`
+}
+
+// EncryptSerializer returns a serializer which encrypts the payloads of
+// serializer with AES-256-GCM. keys is the keyring, newest first: payloads
+// are encrypted with keys[0] and read with the key named in the payload, so
+// sessions written with a retired key stay readable. Unencrypted payloads,
+// e.g. of sessions written before encryption was turned on, are only read
+// with allowUnencrypted, since anyone who can write to the storage could
+// forge them. Payloads are not bound to their session ID, since providers
+// move them to new IDs on SessionRegenerate, so a payload copied to the key
+// of another session in the storage is still read.
+func EncryptSerializer(serializer Serializer, keys []EncryptionKey, allowUnencrypted bool) (Serializer, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: no encryption keys")
+	}
+	s := &encryptSerializer{serializer: serializer, keys: make(map[string]cipher.AEAD, len(keys)), allowUnencrypted: allowUnencrypted}
+	for _, key := range keys {
+		if key.ID == "" || len(key.ID) > 255 {
+			return nil, fmt.Errorf("session: invalid encryption key id %q", key.ID)
+		}
+		if key.Key == "" {
+			return nil, fmt.Errorf("session: encryption key %q is empty", key.ID)
+		}
+		if _, dup := s.keys[key.ID]; dup {
+			return nil, fmt.Errorf("session: duplicate encryption key id %q", key.ID)
+		}
+		aead, err := newAEAD(key.Key, "bhojpur session at rest v1")
+		if err != nil {
+			return nil, err
+		}
+		s.keys[key.ID] = aead
+	}
+	s.current = keys[0].ID
+	return s, nil
+}
+
+type encryptSerializer struct {
+	serializer       Serializer
+	current          string
+	keys             map[string]cipher.AEAD
+	allowUnencrypted bool
+}
+
+// Serialize seals the payload of the wrapped serializer. The result is
+// compressionHeader, encryptedPayloadID, the length and the ID of the key,
+// the nonce and the ciphertext. Everything before the nonce is authenticated.
+func (s *encryptSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	b, err := s.serializer.Serialize(values)
+	if err != nil {
+		return nil, err
+	}
+	aead := s.keys[s.current]
+	header := append([]byte{compressionHeader, encryptedPayloadID, byte(len(s.current))}, s.current...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(header)+len(nonce)+len(b)+aead.Overhead())
+	out = append(append(out, header...), nonce...)
+	return aead.Seal(out, nonce, b, header), nil
+}
+
+func (s *encryptSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	if len(data) < 3 || data[0] != compressionHeader || data[1] != encryptedPayloadID {
+		if !s.allowUnencrypted {
+			return nil, errors.New("session: payload is not encrypted")
+		}
+		return s.serializer.Deserialize(data)
+	}
+	n := 3 + int(data[2])
+	if len(data) < n {
+		return nil, errors.New("session: invalid encrypted payload")
+	}
+	header, id := data[:n], string(data[3:n])
+	aead, ok := s.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("session: unknown encryption key %q", id)
+	}
+	if len(data) < n+aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("session: invalid encrypted payload")
+	}
+	nonce := data[n : n+aead.NonceSize()]
+	b, err := aead.Open(nil, nonce, data[n+aead.NonceSize():], header)
+	if err != nil {
+		return nil, errors.New("session: encrypted payload is not valid")
+	}
+	return s.serializer.Deserialize(b)
+}
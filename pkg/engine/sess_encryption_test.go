@@ -0,0 +1,121 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncryptSerializer(t *testing.T) {
+	values := map[interface{}]interface{}{"email": "user@example.com"}
+	plain := CompressSerializer(GobSerializer{}, nil, 0)
+	oldKeys := []EncryptionKey{{ID: "2021", Key: "old secret"}}
+	oldSerializer, err := EncryptSerializer(plain, oldKeys, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := oldSerializer.Serialize(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(old, []byte("user@example.com")) {
+		t.Fatal("payload is not encrypted")
+	}
+
+	keys := append([]EncryptionKey{{ID: "2022", Key: "new secret"}}, oldKeys...)
+	serializer, err := EncryptSerializer(plain, keys, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := serializer.Serialize(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(b[:8], []byte("2022")) {
+		t.Fatal("expected the id of the newest key in the payload")
+	}
+	// payloads of the newest key and of retired keys are read
+	for _, payload := range [][]byte{b, old} {
+		dst, err := serializer.Deserialize(payload)
+		if err != nil {
+			t.Fatal("deserialize failed:", err)
+		}
+		if dst["email"] != "user@example.com" {
+			t.Fatal("unexpected values", dst)
+		}
+	}
+
+	// unencrypted payloads are only read while migrating
+	unencrypted, _ := plain.Serialize(values)
+	if _, err = serializer.Deserialize(unencrypted); err == nil {
+		t.Fatal("expected error for unencrypted payload")
+	}
+	migrating, err := EncryptSerializer(plain, keys, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst, err := migrating.Deserialize(unencrypted); err != nil || dst["email"] != "user@example.com" {
+		t.Fatal("unencrypted payload was not read while migrating:", dst, err)
+	}
+
+	if _, err = oldSerializer.Deserialize(b); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+	b[len(b)-1] ^= 1
+	if _, err = serializer.Deserialize(b); err == nil {
+		t.Fatal("expected error for tampered payload")
+	}
+
+	for _, keys := range [][]EncryptionKey{
+		nil,
+		{{ID: "", Key: "secret"}},
+		{{ID: "1", Key: ""}},
+		{{ID: "1", Key: "a"}, {ID: "1", Key: "b"}},
+	} {
+		if _, err = EncryptSerializer(plain, keys, false); err == nil {
+			t.Error("expected error for keys", keys)
+		}
+	}
+}
+
+func TestManagerEncryption(t *testing.T) {
+	_, err := NewManager("file", NewManagerConfig(
+		CfgProviderConfig(t.TempDir()),
+		CfgCompression("gzip"),
+		CfgEncryptionKeys(EncryptionKey{ID: "1", Key: "secret"}),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	defer filepder.SetSerializer(nil)
+
+	b, err := filepder.Serializer().Serialize(map[interface{}]interface{}{"username": "bhojpur"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != compressionHeader || b[1] != encryptedPayloadID {
+		t.Fatal("expected encrypted payload")
+	}
+	if _, err = NewManager("file", NewManagerConfig(CfgEncryptionKeys(EncryptionKey{ID: "1"}))); err == nil {
+		t.Fatal("expected error for empty key")
+	}
+}
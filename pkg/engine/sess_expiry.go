@@ -0,0 +1,172 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"time"
+)
+
+// Keys the manager stores in the values of sessions. They are persisted
+// with the values by every provider and should not be set by applications.
+const (
+	// CreatedKey holds the creation time of a session in Unix seconds
+	CreatedKey = "bhojpur.session.created"
+	// AccessedKey holds the time of the last access to a session in Unix seconds
+	AccessedKey = "bhojpur.session.accessed"
+	// LifetimeKey holds the lifetime of a session in seconds, see SetLifetime
+	LifetimeKey = "bhojpur.session.lifetime"
+)
+
+// SetLifetime keeps a session for lifetime instead of the maxLifetime of the
+// manager, e.g. for "remember me" logins. Providers use it for the expiry of
+// the session, and Manager.SessionRelease for the cookie of the session ID.
+func SetLifetime(ctx context.Context, session Store, lifetime time.Duration) error {
+	return session.Set(ctx, LifetimeKey, int64(lifetime/time.Second))
+}
+
+// Lifetime returns the lifetime of a session set with SetLifetime, or 0
+func Lifetime(ctx context.Context, session Store) (time.Duration, error) {
+	v, err := session.Get(ctx, LifetimeKey)
+	if err != nil {
+		return 0, err
+	}
+	lifetime, _ := toInt64(v)
+	return time.Duration(lifetime) * time.Second, nil
+}
+
+// ValuesLifetime returns the lifetime in seconds of a session with values,
+// which is maxlifetime unless it was set with SetLifetime. Providers use it
+// for the expiry of sessions.
+func ValuesLifetime(values map[interface{}]interface{}, maxlifetime int64) int64 {
+	if lifetime, ok := toInt64(values[LifetimeKey]); ok && lifetime > 0 {
+		return lifetime
+	}
+	return maxlifetime
+}
+
+// expired reports whether the session exceeded the idle or absolute timeout
+// of the manager, or was revoked from its user
+func (manager *Manager) expired(ctx context.Context, session Store) (bool, error) {
+	now := time.Now().Unix()
+	if timeout := manager.config.AbsoluteTimeout; timeout > 0 {
+		created, ok, err := storedTime(ctx, session, CreatedKey)
+		if err != nil || ok && now-created >= timeout {
+			return true, err
+		}
+	}
+	if timeout := manager.config.IdleTimeout; timeout > 0 {
+		accessed, ok, err := storedTime(ctx, session, AccessedKey)
+		if err != nil || ok && now-accessed >= timeout {
+			return true, err
+		}
+	}
+	return manager.revoked(ctx, session)
+}
+
+// touch records an access to the session for the expiration policies and
+// the metadata, unless one was recorded within the access granularity.
+// Sessions created before the absolute timeout was set start it now.
+func (manager *Manager) touch(ctx context.Context, session Store) error {
+	now := time.Now().Unix()
+	metadata := manager.config.EnableSessionMetadata
+	if manager.config.AbsoluteTimeout > 0 || metadata {
+		if _, ok, err := storedTime(ctx, session, CreatedKey); err != nil {
+			return err
+		} else if !ok {
+			if err = session.Set(ctx, CreatedKey, now); err != nil {
+				return err
+			}
+		}
+	}
+	if manager.config.IdleTimeout > 0 || metadata {
+		accessed, ok, err := storedTime(ctx, session, AccessedKey)
+		if err != nil {
+			return err
+		}
+		if ok && now-accessed < manager.accessGranularity() {
+			// keep read-only requests from modifying the session
+			return nil
+		}
+		if err = session.Set(ctx, AccessedKey, now); err != nil {
+			return err
+		}
+	}
+	if metadata {
+		return manager.recordMetadata(ctx, session, now)
+	}
+	return nil
+}
+
+// accessGranularity returns the number of seconds in which an access to a
+// session is recorded at most once, see CfgAccessGranularity
+func (manager *Manager) accessGranularity() int64 {
+	if granularity := manager.config.AccessGranularity; granularity != 0 {
+		return granularity
+	}
+	granularity := int64(60)
+	if idle := manager.config.IdleTimeout; idle > 0 && idle/10 < granularity {
+		granularity = idle / 10
+	}
+	return granularity
+}
+
+// storedTime returns a time stored by the manager in Unix seconds
+func storedTime(ctx context.Context, session Store, key string) (int64, bool, error) {
+	v, err := session.Get(ctx, key)
+	if err != nil {
+		return 0, false, err
+	}
+	n, ok := toInt64(v)
+	return n, ok, nil
+}
+
+// toInt64 converts the numbers decoded by the serializers, e.g. float64 by
+// JSON or small integer types by msgpack, to int64
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case float32:
+		return int64(v), true
+	}
+	return 0, false
+}
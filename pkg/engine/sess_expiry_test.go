@@ -0,0 +1,371 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestManagerExpiration(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgSetCookie(true),
+		CfgExpiration(60, 3600),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	ctx := context.Background()
+
+	start := func(sid string) Store {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if sid != "" {
+			r.AddCookie(&http.Cookie{Name: "bsessionid", Value: sid})
+		}
+		sess, err := manager.SessionStart(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatal("session start failed:", err)
+		}
+		return sess
+	}
+
+	sess := start("")
+	sid := sess.SessionID(ctx)
+	if created, _ := sess.Get(ctx, CreatedKey); created == nil {
+		t.Fatal("creation time was not stored")
+	}
+	if start(sid).SessionID(ctx) != sid {
+		t.Fatal("session expired too early")
+	}
+
+	for _, key := range []string{AccessedKey, CreatedKey} {
+		sess = start(sid)
+		sess.Set(ctx, key, time.Now().Add(-2*time.Hour).Unix())
+		if sess = start(sid); sess.SessionID(ctx) == sid {
+			t.Fatalf("session did not expire by %s", key)
+		}
+		if exists, _ := manager.GetProvider().SessionExist(ctx, sid); exists {
+			t.Fatal("expired session was not destroyed")
+		}
+		sid = sess.SessionID(ctx)
+	}
+
+	// times decoded by the JSON serializer
+	sess.Set(ctx, AccessedKey, float64(time.Now().Unix()))
+	if start(sid).SessionID(ctx) != sid {
+		t.Fatal("session with float time expired")
+	}
+}
+
+func TestSessionLifetime(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgSetCookie(true),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, err := manager.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	if lifetime, _ := Lifetime(r.Context(), sess); lifetime != 0 {
+		t.Fatal("unexpected lifetime", lifetime)
+	}
+	if err = SetLifetime(r.Context(), sess, 30*24*time.Hour); err != nil {
+		t.Fatal("set lifetime failed:", err)
+	}
+
+	// the cookie expires with the session
+	w := httptest.NewRecorder()
+	if err = manager.SessionRelease(r.Context(), w, sess); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge != 30*24*60*60 || cookies[0].Value != sess.SessionID(nil) {
+		t.Fatalf("unexpected cookies %v", cookies)
+	}
+
+	// the memory provider keeps it beyond maxLifetime
+	provider := manager.GetProvider().(*MemProvider)
+	store := sess.(*MemSessionStore)
+	store.timeAccessed = time.Now().Add(-2 * time.Hour)
+	provider.SessionGC(nil)
+	if exists, _ := provider.SessionExist(nil, store.sid); !exists {
+		t.Fatal("session with its own lifetime was collected")
+	}
+	store.Delete(nil, LifetimeKey)
+	provider.SessionGC(nil)
+	if exists, _ := provider.SessionExist(nil, store.sid); exists {
+		t.Fatal("expired session was not collected")
+	}
+
+	if got := ValuesLifetime(map[interface{}]interface{}{LifetimeKey: float64(60)}, 3600); got != 60 {
+		t.Fatal("unexpected lifetime of JSON values", got)
+	}
+}
+
+func TestSessionMetadata(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgSetCookie(true),
+		CfgSessionMetadata(true),
+		CfgAccessGranularity(-1),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	ctx := context.Background()
+
+	var sid string
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		r.Header.Set("User-Agent", "test-agent")
+		if sid != "" {
+			r.AddCookie(&http.Cookie{Name: "bsessionid", Value: sid})
+		}
+		sess, err := manager.SessionStart(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatal("session start failed:", err)
+		}
+		sid = sess.SessionID(ctx)
+	}
+
+	sess, _ := manager.GetSessionStore(sid)
+	md, err := GetMetadata(ctx, sess)
+	if err != nil {
+		t.Fatal("could not get metadata:", err)
+	}
+	if md.Created.IsZero() || md.LastAccess.IsZero() {
+		t.Fatal("times were not recorded", md)
+	}
+	if md.IP != "192.0.2.1" || md.UserAgent != "test-agent" || md.Requests != 2 {
+		t.Fatal("unexpected metadata", md)
+	}
+
+	// metadata decoded by the JSON serializer
+	sess.Set(ctx, RequestsKey, float64(5))
+	if md, _ = GetMetadata(ctx, sess); md.Requests != 5 {
+		t.Fatal("unexpected request count of JSON values", md.Requests)
+	}
+}
+
+// versionProvider keeps copies of the values of sessions with a version, to
+// check versions on release like the providers with external storage
+type versionProvider struct {
+	ProviderVersionCheck
+
+	mu       sync.Mutex
+	sessions map[string]*versionStore
+}
+
+func (p *versionProvider) SessionInit(ctx context.Context, gclifetime int64, config string) error {
+	p.sessions = make(map[string]*versionStore)
+	return nil
+}
+
+func (p *versionProvider) SessionRead(ctx context.Context, sid string) (Store, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := &versionStore{p: p, sid: sid, values: make(map[interface{}]interface{}), dirty: true}
+	if stored, ok := p.sessions[sid]; ok {
+		st.version, st.dirty = stored.version, false
+		for k, v := range stored.values {
+			st.values[k] = v
+		}
+	}
+	return st, nil
+}
+
+func (p *versionProvider) SessionExist(ctx context.Context, sid string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.sessions[sid]
+	return ok, nil
+}
+
+func (p *versionProvider) SessionRegenerate(ctx context.Context, oldsid, sid string) (Store, error) {
+	p.mu.Lock()
+	if stored, ok := p.sessions[oldsid]; ok {
+		delete(p.sessions, oldsid)
+		p.sessions[sid] = stored
+	}
+	p.mu.Unlock()
+	return p.SessionRead(ctx, sid)
+}
+
+func (p *versionProvider) SessionDestroy(ctx context.Context, sid string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.sessions, sid)
+	return nil
+}
+
+func (p *versionProvider) SessionAll(ctx context.Context) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sessions)
+}
+
+func (p *versionProvider) SessionGC(ctx context.Context) {}
+
+type versionStore struct {
+	p       *versionProvider
+	sid     string
+	version int
+	values  map[interface{}]interface{}
+	dirty   bool
+}
+
+func (st *versionStore) Set(ctx context.Context, key, value interface{}) error {
+	st.values[key] = value
+	st.dirty = true
+	return nil
+}
+
+func (st *versionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	return st.values[key], nil
+}
+
+func (st *versionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	return st.values
+}
+
+func (st *versionStore) Delete(ctx context.Context, key interface{}) error {
+	delete(st.values, key)
+	st.dirty = true
+	return nil
+}
+
+func (st *versionStore) SessionID(ctx context.Context) string {
+	return st.sid
+}
+
+func (st *versionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	if !st.dirty {
+		return nil
+	}
+	st.p.mu.Lock()
+	defer st.p.mu.Unlock()
+	stored, ok := st.p.sessions[st.sid]
+	if st.p.VersionCheck() && ok && stored.version != st.version {
+		return ErrSessionConflict
+	}
+	st.version++
+	st.dirty = false
+	st.p.sessions[st.sid] = &versionStore{sid: st.sid, version: st.version, values: st.values}
+	return nil
+}
+
+func (st *versionStore) Flush(ctx context.Context) error {
+	st.values = make(map[interface{}]interface{})
+	st.dirty = true
+	return nil
+}
+
+func TestAccessGranularity(t *testing.T) {
+	Register("versioned", &versionProvider{})
+	manager, err := NewManager("versioned", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgSetCookie(true),
+		CfgVersionCheck(true),
+		CfgExpiration(3600, 0),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	ctx := context.Background()
+
+	start := func(sid string) Store {
+		r, _ := http.NewRequest("GET", "/", nil)
+		if sid != "" {
+			r.AddCookie(&http.Cookie{Name: "bsessionid", Value: sid})
+		}
+		sess, err := manager.SessionStart(httptest.NewRecorder(), r)
+		if err != nil {
+			t.Fatal("session start failed:", err)
+		}
+		return sess
+	}
+
+	sess := start("")
+	sid := sess.SessionID(ctx)
+	sess.Set(ctx, "username", "bhojpur")
+	if err = manager.SessionRelease(ctx, httptest.NewRecorder(), sess); err != nil {
+		t.Fatal("release failed:", err)
+	}
+
+	// concurrent read-only requests within the granularity neither write
+	// the session nor conflict with each other
+	var started, wg sync.WaitGroup
+	errs := make(chan error, 2)
+	started.Add(2)
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "/", nil)
+			r.AddCookie(&http.Cookie{Name: "bsessionid", Value: sid})
+			sess, err := manager.SessionStart(httptest.NewRecorder(), r)
+			started.Done()
+			if err != nil {
+				errs <- err
+				return
+			}
+			started.Wait()
+			if v, _ := sess.Get(ctx, "username"); v != "bhojpur" {
+				t.Error("unexpected username", v)
+			}
+			errs <- manager.SessionRelease(ctx, httptest.NewRecorder(), sess)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal("read-only request failed:", err)
+		}
+	}
+
+	// an access older than the granularity is recorded
+	sess = start(sid)
+	old := time.Now().Add(-time.Hour).Unix()
+	sess.Set(ctx, AccessedKey, old)
+	if err = manager.SessionRelease(ctx, httptest.NewRecorder(), sess); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	sess = start(sid)
+	if accessed, _, _ := storedTime(ctx, sess, AccessedKey); accessed == old {
+		t.Fatal("access was not recorded")
+	}
+}
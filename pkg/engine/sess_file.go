@@ -41,9 +41,10 @@ var (
 
 // FileSessionStore File session store
 type FileSessionStore struct {
-	sid    string
-	lock   sync.RWMutex
-	values map[interface{}]interface{}
+	sid        string
+	lock       sync.RWMutex
+	values     map[interface{}]interface{}
+	serializer Serializer
 }
 
 // Set value to file session
@@ -55,13 +56,24 @@ func (fs *FileSessionStore) Set(ctx context.Context, key, value interface{}) err
 }
 
 // Get value from file session
-func (fs *FileSessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (fs *FileSessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	fs.lock.RLock()
 	defer fs.lock.RUnlock()
 	if v, ok := fs.values[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in file session
+func (fs *FileSessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	fs.lock.RLock()
+	defer fs.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(fs.values))
+	for k, v := range fs.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete value in file session by given key
@@ -86,39 +98,54 @@ func (fs *FileSessionStore) SessionID(context.Context) string {
 }
 
 // SessionRelease Write file session to local file with Gob string
-func (fs *FileSessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
+func (fs *FileSessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
 	filepder.lock.Lock()
 	defer filepder.lock.Unlock()
-	b, err := EncodeGob(fs.values)
+	b, err := fs.serializer.Serialize(fs.values)
 	if err != nil {
-		SLogger.Println(err)
-		return
+		return err
 	}
 	_, err = os.Stat(path.Join(filepder.savePath, string(fs.sid[0]), string(fs.sid[1]), fs.sid))
 	var f *os.File
 	if err == nil {
 		f, err = os.OpenFile(path.Join(filepder.savePath, string(fs.sid[0]), string(fs.sid[1]), fs.sid), os.O_RDWR, 0777)
 		if err != nil {
-			SLogger.Println(err)
-			return
+			return err
 		}
 	} else if os.IsNotExist(err) {
 		f, err = os.Create(path.Join(filepder.savePath, string(fs.sid[0]), string(fs.sid[1]), fs.sid))
 		if err != nil {
-			SLogger.Println(err)
-			return
+			return err
 		}
 	} else {
-		return
+		return err
+	}
+	defer f.Close()
+	if err = f.Truncate(0); err != nil {
+		return err
 	}
-	f.Truncate(0)
-	f.Seek(0, 0)
-	f.Write(b)
-	f.Close()
+	if _, err = f.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		return err
+	}
+	return touchFile(f.Name(), fs.values, filepder.maxlifetime)
+}
+
+// touchFile sets the modification time of a session file, which SessionGC
+// compares with maxlifetime, so that the session expires after its lifetime
+func touchFile(name string, values map[interface{}]interface{}, maxlifetime int64) error {
+	now := time.Now()
+	shift := time.Duration(ValuesLifetime(values, maxlifetime)-maxlifetime) * time.Second
+	return os.Chtimes(name, now, now.Add(shift))
 }
 
 // FileProvider File session provider
 type FileProvider struct {
+	ProviderSerializer
+	LocalLocker
+
 	lock        sync.RWMutex
 	maxlifetime int64
 	savePath    string
@@ -162,7 +189,6 @@ func (fp *FileProvider) SessionRead(ctx context.Context, sid string) (Store, err
 
 	defer f.Close()
 
-	os.Chtimes(path.Join(fp.savePath, string(sid[0]), string(sid[1]), sid), time.Now(), time.Now())
 	var kv map[interface{}]interface{}
 	b, err := ioutil.ReadAll(f)
 	if err != nil {
@@ -171,13 +197,14 @@ func (fp *FileProvider) SessionRead(ctx context.Context, sid string) (Store, err
 	if len(b) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = DecodeGob(b)
+		kv, err = fp.Serializer().Deserialize(b)
 		if err != nil {
 			return nil, err
 		}
 	}
+	touchFile(path.Join(fp.savePath, string(sid[0]), string(sid[1]), sid), kv, fp.maxlifetime)
 
-	ss := &FileSessionStore{sid: sid, values: kv}
+	ss := &FileSessionStore{sid: sid, values: kv, serializer: fp.Serializer()}
 	return ss, nil
 }
 
@@ -265,7 +292,7 @@ func (fp *FileProvider) SessionRegenerate(ctx context.Context, oldsid, sid strin
 		if len(b) == 0 {
 			kv = make(map[interface{}]interface{})
 		} else {
-			kv, err = DecodeGob(b)
+			kv, err = fp.Serializer().Deserialize(b)
 			if err != nil {
 				return nil, err
 			}
@@ -274,7 +301,7 @@ func (fp *FileProvider) SessionRegenerate(ctx context.Context, oldsid, sid strin
 		ioutil.WriteFile(newSidFile, b, 0777)
 		os.Remove(oldSidFile)
 		os.Chtimes(newSidFile, time.Now(), time.Now())
-		ss := &FileSessionStore{sid: sid, values: kv}
+		ss := &FileSessionStore{sid: sid, values: kv, serializer: fp.Serializer()}
 		return ss, nil
 	}
 
@@ -284,7 +311,7 @@ func (fp *FileProvider) SessionRegenerate(ctx context.Context, oldsid, sid strin
 		return nil, err
 	}
 	newf.Close()
-	ss := &FileSessionStore{sid: sid, values: make(map[interface{}]interface{})}
+	ss := &FileSessionStore{sid: sid, values: make(map[interface{}]interface{}), serializer: fp.Serializer()}
 	return ss, nil
 }
 
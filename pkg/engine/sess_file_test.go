@@ -134,7 +134,7 @@ func TestFileProvider_SessionRead(t *testing.T) {
 	}
 
 	_ = s.Set(nil, "sessionValue", 18975)
-	v := s.Get(nil, "sessionValue")
+	v, _ := s.Get(nil, "sessionValue")
 
 	if v.(int) != 18975 {
 		t.Error()
@@ -323,7 +323,7 @@ func TestFileSessionStore_Get(t *testing.T) {
 	for i := 1; i <= sessionCount; i++ {
 		_ = s.Set(nil, i, i)
 
-		v := s.Get(nil, i)
+		v, _ := s.Get(nil, i)
 		if v.(int) != i {
 			t.Error()
 		}
@@ -342,13 +342,13 @@ func TestFileSessionStore_Delete(t *testing.T) {
 	s, _ := fp.SessionRead(context.Background(), sid)
 	s.Set(nil, "1", 1)
 
-	if s.Get(nil, "1") == nil {
+	if v, _ := s.Get(nil, "1"); v == nil {
 		t.Error()
 	}
 
 	s.Delete(nil, "1")
 
-	if s.Get(nil, "1") != nil {
+	if v, _ := s.Get(nil, "1"); v != nil {
 		t.Error()
 	}
 }
@@ -371,7 +371,7 @@ func TestFileSessionStore_Flush(t *testing.T) {
 	_ = s.Flush(nil)
 
 	for i := 1; i <= sessionCount; i++ {
-		if s.Get(nil, i) != nil {
+		if v, _ := s.Get(nil, i); v != nil {
 			t.Error()
 		}
 	}
@@ -417,7 +417,9 @@ func TestFileSessionStore_SessionRelease(t *testing.T) {
 		}
 
 		s.Set(nil, i, i)
-		s.SessionRelease(nil, nil)
+		if err = s.SessionRelease(nil, nil); err != nil {
+			t.Error(err)
+		}
 	}
 
 	for i := 1; i <= sessionCount; i++ {
@@ -426,7 +428,7 @@ func TestFileSessionStore_SessionRelease(t *testing.T) {
 			t.Error(err)
 		}
 
-		if s.Get(nil, i).(int) != i {
+		if v, _ := s.Get(nil, i); v.(int) != i {
 			t.Error()
 		}
 	}
@@ -0,0 +1,202 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrSessionLockTimeout is returned by SessionStart when the lock of the
+// session could not be acquired within SessionLockTimeout
+var ErrSessionLockTimeout = errors.New("session: timed out waiting for the session lock")
+
+// SessionLocker is implemented by providers which can lock a session, so
+// that concurrent requests for it are served one after another. SessionLock
+// blocks until the lock is acquired or ctx is done. ttl bounds how long the
+// lock of a crashed process is held, where the provider supports it.
+type SessionLocker interface {
+	SessionLock(ctx context.Context, sid string, ttl time.Duration) (unlock func(ctx context.Context) error, err error)
+}
+
+// LocalLocker is embedded by providers to implement SessionLocker with locks
+// local to the process
+type LocalLocker struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+// SessionLock lock the session sid within the process. A positive ttl
+// releases the lock after ttl if it was not unlocked before.
+func (l *LocalLocker) SessionLock(ctx context.Context, sid string, ttl time.Duration) (func(context.Context) error, error) {
+	for {
+		l.mu.Lock()
+		if l.locks == nil {
+			l.locks = make(map[string]chan struct{})
+		}
+		held, ok := l.locks[sid]
+		if !ok {
+			released := make(chan struct{})
+			l.locks[sid] = released
+			l.mu.Unlock()
+			var once sync.Once
+			release := func() {
+				once.Do(func() {
+					l.mu.Lock()
+					delete(l.locks, sid)
+					l.mu.Unlock()
+					close(released)
+				})
+			}
+			var expiry *time.Timer
+			if ttl > 0 {
+				expiry = time.AfterFunc(ttl, release)
+			}
+			return func(context.Context) error {
+				if expiry != nil {
+					expiry.Stop()
+				}
+				release()
+				return nil
+			}, nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// WaitLock calls tryLock until it acquires a lock, fails or ctx is done.
+// It helps providers whose locks cannot block.
+func WaitLock(ctx context.Context, tryLock func() (bool, error)) error {
+	delay := 5 * time.Millisecond
+	for {
+		locked, err := tryLock()
+		if err != nil || locked {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		if delay < 100*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
+// sessionLock is a session lock held by a manager
+type sessionLock struct {
+	sid    string
+	unlock func(context.Context) error
+	once   sync.Once
+	err    error
+}
+
+// lockedStore releases its session lock with the session
+type lockedStore struct {
+	Store
+	manager *Manager
+	lock    *sessionLock
+}
+
+func (st *lockedStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	err := st.Store.SessionRelease(ctx, w)
+	if uerr := st.manager.releaseLock(st.lock); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+type listingLockedStore struct {
+	lockedStore
+	ValueLister
+}
+
+// readLocked locks the session sid and reads it. The lock is held until
+// the session is released or destroyed.
+func (manager *Manager) readLocked(ctx context.Context, sid string) (Store, error) {
+	lockCtx, cancel := context.WithTimeout(ctx, time.Duration(manager.config.SessionLockTimeout)*time.Second)
+	defer cancel()
+	unlock, err := manager.locker.SessionLock(lockCtx, sid, time.Duration(manager.config.SessionLockTTL)*time.Second)
+	if err != nil {
+		if ctx.Err() == nil && lockCtx.Err() == context.DeadlineExceeded {
+			return nil, ErrSessionLockTimeout
+		}
+		return nil, err
+	}
+	lock := &sessionLock{sid: sid, unlock: unlock}
+	manager.locksMu.Lock()
+	manager.locks[sid] = lock
+	manager.locksMu.Unlock()
+
+	session, err := manager.provider.SessionRead(ctx, sid)
+	if err != nil {
+		manager.releaseLock(lock)
+		return nil, err
+	}
+	locked := lockedStore{session, manager, lock}
+	if l, ok := session.(ValueLister); ok {
+		return &listingLockedStore{locked, l}, nil
+	}
+	return &locked, nil
+}
+
+// unlockSession releases the lock of sid held by manager, if any
+func (manager *Manager) unlockSession(sid string) error {
+	if manager.locker == nil {
+		return nil
+	}
+	manager.locksMu.Lock()
+	lock, ok := manager.locks[sid]
+	manager.locksMu.Unlock()
+	if !ok {
+		return nil
+	}
+	return manager.releaseLock(lock)
+}
+
+// releaseLock releases lock once. It is not cancelled with the request, so
+// that locks are not left behind.
+func (manager *Manager) releaseLock(lock *sessionLock) error {
+	manager.locksMu.Lock()
+	if manager.locks[lock.sid] == lock {
+		delete(manager.locks, lock.sid)
+	}
+	manager.locksMu.Unlock()
+
+	lock.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(manager.config.SessionLockTimeout)*time.Second)
+		defer cancel()
+		lock.err = lock.unlock(ctx)
+	})
+	return lock.err
+}
@@ -0,0 +1,159 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLocalLocker(t *testing.T) {
+	var locker LocalLocker
+	unlock, err := locker.SessionLock(context.Background(), "sid", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = locker.SessionLock(ctx, "sid", 0); err != context.DeadlineExceeded {
+		t.Fatal("expected the lock to be held, got", err)
+	}
+	if other, err := locker.SessionLock(ctx, "other", 0); err != nil {
+		t.Fatal("expected the lock of another session, got", err)
+	} else {
+		other(nil)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		unlock, err := locker.SessionLock(context.Background(), "sid", 0)
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock(nil)
+		}
+		close(acquired)
+	}()
+	unlock(nil)
+	unlock(nil)
+	<-acquired
+}
+
+func TestLocalLockerTTL(t *testing.T) {
+	var locker LocalLocker
+	expired, err := locker.SessionLock(context.Background(), "sid", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lock of a holder which never unlocks is released after the ttl
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	unlock, err := locker.SessionLock(ctx, "sid", 0)
+	if err != nil {
+		t.Fatal("expected the lock to expire, got", err)
+	}
+
+	// unlocking the expired lock does not release the new one
+	expired(nil)
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = locker.SessionLock(ctx, "sid", 0); err != context.DeadlineExceeded {
+		t.Fatal("expected the lock to be held, got", err)
+	}
+	unlock(nil)
+}
+
+func TestManagerSessionLock(t *testing.T) {
+	if _, err := NewManager("cookie", NewManagerConfig(CfgSessionLock(1, 60))); err == nil {
+		t.Fatal("expected error for provider without locks")
+	}
+
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgSetCookie(true),
+		CfgSessionLock(1, 60),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, err := manager.SessionStart(w, r)
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	manager.SessionRelease(r.Context(), w, sess)
+	cookie := w.Result().Cookies()[0]
+	start := func() (Store, error) {
+		r, _ := http.NewRequest("GET", "/", nil)
+		r.AddCookie(cookie)
+		return manager.SessionStart(httptest.NewRecorder(), r)
+	}
+
+	first, err := start()
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	if _, ok := first.(ValueLister); !ok {
+		t.Fatal("expected locked session to list values")
+	}
+	started := make(chan Store)
+	go func() {
+		second, err := start()
+		if err != nil {
+			t.Error("session start failed:", err)
+		}
+		started <- second
+	}()
+	select {
+	case <-started:
+		t.Fatal("session started while it is locked")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Set(nil, "username", "bhojpur")
+	if err = manager.SessionRelease(nil, nil, first); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	second := <-started
+	if username, _ := second.Get(nil, "username"); username != "bhojpur" {
+		t.Fatal("expected the value set by the first request")
+	}
+
+	if _, err = start(); err != ErrSessionLockTimeout {
+		t.Fatal("expected ErrSessionLockTimeout, got", err)
+	}
+
+	// destroying the session releases its lock
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.AddCookie(cookie)
+	manager.SessionDestroy(httptest.NewRecorder(), r)
+	if len(manager.locks) != 0 {
+		t.Fatal("lock not released on destroy")
+	}
+	second.SessionRelease(nil, nil)
+}
@@ -24,6 +24,7 @@ import (
 	"container/list"
 	"context"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 )
@@ -48,13 +49,24 @@ func (st *MemSessionStore) Set(ctx context.Context, key, value interface{}) erro
 }
 
 // Get value from memory session by key
-func (st *MemSessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (st *MemSessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	st.lock.RLock()
 	defer st.lock.RUnlock()
 	if v, ok := st.value[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in memory session
+func (st *MemSessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.value))
+	for k, v := range st.value {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete in memory session by key
@@ -79,20 +91,26 @@ func (st *MemSessionStore) SessionID(context.Context) string {
 }
 
 // SessionRelease Implement method, no used.
-func (st *MemSessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
+func (st *MemSessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	return nil
 }
 
 // MemProvider Implement the provider interface
 type MemProvider struct {
-	lock        sync.RWMutex             // locker
-	sessions    map[string]*list.Element // map in memory
-	list        *list.List               // for gc
+	LocalLocker
+
+	lock        sync.RWMutex                // locker
+	sessions    map[string]*list.Element    // map in memory
+	list        *list.List                  // for gc
+	users       map[string]map[string]int64 // creation times of the sessions of users, see UserIndexer
 	maxlifetime int64
 	savePath    string
 }
 
 // SessionInit init memory session
 func (pder *MemProvider) SessionInit(ctx context.Context, maxlifetime int64, savePath string) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
 	pder.maxlifetime = maxlifetime
 	pder.savePath = savePath
 	return nil
@@ -154,31 +172,103 @@ func (pder *MemProvider) SessionDestroy(ctx context.Context, sid string) error {
 	if element, ok := pder.sessions[sid]; ok {
 		delete(pder.sessions, sid)
 		pder.list.Remove(element)
+		pder.unindexUser(element.Value.(*MemSessionStore))
 		return nil
 	}
 	return nil
 }
 
-// SessionGC clean expired session stores in memory session
+// SessionGC clean expired session stores in memory session.
+// Sessions with their own lifetime are kept for it.
 func (pder *MemProvider) SessionGC(context.Context) {
+	now := time.Now().Unix()
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	for element := pder.list.Back(); element != nil; {
+		prev := element.Prev()
+		if st := element.Value.(*MemSessionStore); st.expired(now, pder.maxlifetime) {
+			pder.list.Remove(element)
+			delete(pder.sessions, st.sid)
+			pder.unindexUser(st)
+		}
+		element = prev
+	}
+}
+
+// expired reports whether the session was not accessed for its lifetime
+func (st *MemSessionStore) expired(now, maxlifetime int64) bool {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	return st.timeAccessed.Unix()+ValuesLifetime(st.value, maxlifetime) < now
+}
+
+// SessionIndexUser add sid to the sessions of user, see UserIndexer
+func (pder *MemProvider) SessionIndexUser(ctx context.Context, user, sid string, created time.Time, lifetime time.Duration) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	if pder.users == nil {
+		pder.users = make(map[string]map[string]int64)
+	}
+	if pder.users[user] == nil {
+		pder.users[user] = make(map[string]int64)
+	}
+	pder.users[user][sid] = created.UnixNano()
+	return nil
+}
+
+// SessionUnindexUser remove sid from the sessions of user
+func (pder *MemProvider) SessionUnindexUser(ctx context.Context, user, sid string) error {
+	pder.lock.Lock()
+	defer pder.lock.Unlock()
+	pder.unindex(user, sid)
+	return nil
+}
+
+// SessionsOfUser return the sessions of user, oldest first
+func (pder *MemProvider) SessionsOfUser(ctx context.Context, user string) ([]string, error) {
 	pder.lock.RLock()
-	for {
-		element := pder.list.Back()
-		if element == nil {
-			break
+	defer pder.lock.RUnlock()
+	created := pder.users[user]
+	sids := make([]string, 0, len(created))
+	for sid := range created {
+		sids = append(sids, sid)
+	}
+	sort.Slice(sids, func(i, j int) bool {
+		if created[sids[i]] != created[sids[j]] {
+			return created[sids[i]] < created[sids[j]]
 		}
-		if (element.Value.(*MemSessionStore).timeAccessed.Unix() + pder.maxlifetime) < time.Now().Unix() {
-			pder.lock.RUnlock()
-			pder.lock.Lock()
-			pder.list.Remove(element)
-			delete(pder.sessions, element.Value.(*MemSessionStore).sid)
-			pder.lock.Unlock()
-			pder.lock.RLock()
-		} else {
-			break
+		return sids[i] < sids[j]
+	})
+	return sids, nil
+}
+
+// SessionUserIndexed report whether sid is one of the sessions of user
+func (pder *MemProvider) SessionUserIndexed(ctx context.Context, user, sid string) (bool, error) {
+	pder.lock.RLock()
+	defer pder.lock.RUnlock()
+	_, ok := pder.users[user][sid]
+	return ok, nil
+}
+
+// unindexUser removes a session which is gone from the sessions of its user.
+// pder.lock must be held.
+func (pder *MemProvider) unindexUser(st *MemSessionStore) {
+	st.lock.RLock()
+	user, _ := st.value[UserKey].(string)
+	st.lock.RUnlock()
+	if user != "" {
+		pder.unindex(user, st.sid)
+	}
+}
+
+// unindex removes sid from the sessions of user. pder.lock must be held.
+func (pder *MemProvider) unindex(user, sid string) {
+	if sids, ok := pder.users[user]; ok {
+		delete(sids, sid)
+		if len(sids) == 0 {
+			delete(pder.users, user)
 		}
 	}
-	pder.lock.RUnlock()
 }
 
 // SessionAll get count number of memory session
@@ -21,6 +21,7 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -35,7 +36,9 @@ func TestMem(t *testing.T) {
 		t.Fatal("json decode error", err)
 	}
 	globalSessions, _ := NewManager("memory", conf)
-	go globalSessions.GC()
+	gcCtx, stopGC := context.WithCancel(context.Background())
+	defer stopGC()
+	go globalSessions.GCContext(gcCtx)
 	r, _ := http.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
 	sess, err := globalSessions.SessionStart(w, r)
@@ -47,7 +50,7 @@ func TestMem(t *testing.T) {
 	if err != nil {
 		t.Fatal("set error,", err)
 	}
-	if username := sess.Get(nil, "username"); username != "bhojpur" {
+	if username, _ := sess.Get(nil, "username"); username != "bhojpur" {
 		t.Fatal("get username error")
 	}
 	if cookiestr := w.Header().Get("Set-Cookie"); cookiestr == "" {
@@ -0,0 +1,100 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Keys of the metadata the manager stores in the values of sessions with
+// EnableSessionMetadata, besides CreatedKey and AccessedKey
+const (
+	// IPKey holds the IP address of the last recorded access to a session
+	IPKey = "bhojpur.session.ip"
+	// UserAgentKey holds the User-Agent header of the last recorded access to
+	// a session
+	UserAgentKey = "bhojpur.session.useragent"
+	// RequestsKey holds the number of recorded accesses to a session, at most
+	// one per access granularity, see CfgAccessGranularity
+	RequestsKey = "bhojpur.session.requests"
+)
+
+// Metadata describes the use of a session, e.g. to show users where they
+// are logged in. It's recorded by SessionStart with EnableSessionMetadata.
+type Metadata struct {
+	Created    time.Time
+	LastAccess time.Time
+	IP         string
+	UserAgent  string
+	Requests   int64
+}
+
+// GetMetadata returns the metadata of a session. Fields which were not
+// recorded are zero.
+func GetMetadata(ctx context.Context, session Store) (Metadata, error) {
+	var md Metadata
+	values := make(map[string]interface{}, 5)
+	for _, key := range []string{CreatedKey, AccessedKey, IPKey, UserAgentKey, RequestsKey} {
+		v, err := session.Get(ctx, key)
+		if err != nil {
+			return md, err
+		}
+		values[key] = v
+	}
+	if created, ok := toInt64(values[CreatedKey]); ok {
+		md.Created = time.Unix(created, 0)
+	}
+	if accessed, ok := toInt64(values[AccessedKey]); ok {
+		md.LastAccess = time.Unix(accessed, 0)
+	}
+	md.IP, _ = values[IPKey].(string)
+	md.UserAgent, _ = values[UserAgentKey].(string)
+	md.Requests, _ = toInt64(values[RequestsKey])
+	return md, nil
+}
+
+// recordMetadata records an access to the session. The client is only known
+// for sessions started for HTTP requests.
+func (manager *Manager) recordMetadata(ctx context.Context, session Store, now int64) error {
+	requests, err := session.Get(ctx, RequestsKey)
+	if err != nil {
+		return err
+	}
+	count, _ := toInt64(requests)
+	if err = session.Set(ctx, RequestsKey, count+1); err != nil {
+		return err
+	}
+	if r := RequestFromContext(ctx); r != nil {
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		if err = session.Set(ctx, IPKey, ip); err != nil {
+			return err
+		}
+		if err = session.Set(ctx, UserAgentKey, r.UserAgent()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+)
+
+type sessionContextKey struct{}
+
+// requestSession is the session of a request served by Manager.Middleware
+type requestSession struct {
+	manager *Manager
+	ctx     context.Context
+	w       http.ResponseWriter
+
+	mu       sync.Mutex
+	store    Store // nil once the session was destroyed
+	released bool
+}
+
+// Middleware returns a handler which starts the session of every request
+// before calling next, and releases it before the response headers are
+// written, or once next returns if it wrote nothing. Handlers get the session
+// with FromContext and must not release it themselves.
+//
+// Requests whose session cannot be started are answered with status 500.
+// Errors of releasing the session are reported to the error hook.
+func (manager *Manager) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store, err := manager.SessionStart(w, r)
+		if err != nil {
+			manager.reportError(r.Context(), "", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		s := &requestSession{manager: manager, w: w, store: store}
+		r = r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, s))
+		s.ctx = contextWithRequest(r)
+		defer s.release()
+		next.ServeHTTP(newSessionResponseWriter(w, s), r)
+	})
+}
+
+// FromContext returns the session of a request served by Manager.Middleware,
+// or nil for other contexts. The session is saved before the response is
+// written, so values set after the first Write or WriteHeader are not saved.
+func FromContext(ctx context.Context) Store {
+	s := requestSessionFromContext(ctx)
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store
+}
+
+func requestSessionFromContext(ctx context.Context) *requestSession {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(sessionContextKey{}).(*requestSession)
+	return s
+}
+
+// replace makes store the session of the request, it's called when the
+// session is regenerated or destroyed by the handler
+func (s *requestSession) replace(store Store) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.store = store
+}
+
+// release saves the session the first time it's called
+func (s *requestSession) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.released {
+		return
+	}
+	s.released = true
+	if s.store != nil {
+		s.manager.SessionRelease(s.ctx, s.w, s.store)
+	}
+}
+
+// sessionResponseWriter releases the session before anything is written
+type sessionResponseWriter struct {
+	http.ResponseWriter
+	session *requestSession
+}
+
+// newSessionResponseWriter wraps w so that it implements http.Flusher and
+// http.Hijacker only if w does
+func newSessionResponseWriter(w http.ResponseWriter, s *requestSession) http.ResponseWriter {
+	sw := &sessionResponseWriter{ResponseWriter: w, session: s}
+	_, flusher := w.(http.Flusher)
+	_, hijacker := w.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return &flushHijackWriter{sw}
+	case flusher:
+		return &flushWriter{sw}
+	case hijacker:
+		return &hijackWriter{sw}
+	}
+	return sw
+}
+
+func (w *sessionResponseWriter) WriteHeader(statusCode int) {
+	w.session.release()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *sessionResponseWriter) Write(b []byte) (int, error) {
+	w.session.release()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *sessionResponseWriter) flush() {
+	w.session.release()
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *sessionResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.session.release()
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, see http.ResponseController
+func (w *sessionResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type flushWriter struct {
+	*sessionResponseWriter
+}
+
+func (w *flushWriter) Flush() {
+	w.flush()
+}
+
+type hijackWriter struct {
+	*sessionResponseWriter
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+type flushHijackWriter struct {
+	*sessionResponseWriter
+}
+
+func (w *flushHijackWriter) Flush() {
+	w.flush()
+}
+
+func (w *flushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
@@ -0,0 +1,137 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	manager, err := NewManager("cookie", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgProviderConfig(`{"cookieName":"bsessionid","securityKey":"bhojpurcookiehashkey"}`),
+	))
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+	if FromContext(context.Background()) != nil {
+		t.Fatal("expected no session outside the middleware")
+	}
+
+	// the session is written before the body although nothing releases it
+	handler := manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := FromContext(r.Context())
+		if sess == nil {
+			t.Fatal("no session in the request context")
+		}
+		sess.Set(r.Context(), "username", "bhojpur")
+		io.WriteString(w, "hello")
+	}))
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	handler.ServeHTTP(w, r)
+	if w.Body.String() != "hello" {
+		t.Fatal("unexpected body", w.Body.String())
+	}
+	cookie := w.Header().Get("Set-Cookie")
+	if !strings.HasPrefix(cookie, "bsessionid=") {
+		t.Fatal("session was not written:", w.Header())
+	}
+
+	// handlers which write nothing
+	handler = manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, _ := FromContext(r.Context()).Get(r.Context(), "username"); username != "bhojpur" {
+			t.Fatal("session was not read, got", username)
+		}
+	}))
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", cookie)
+	handler.ServeHTTP(w, r)
+	if w.Header().Get("Set-Cookie") == "" {
+		t.Fatal("session was not written:", w.Header())
+	}
+}
+
+func TestMiddlewareRegenerateDestroy(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgSetCookie(true),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+
+	handler := manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		oldsid := FromContext(r.Context()).SessionID(nil)
+		regenerated, _ := manager.SessionRegenerateID(w, r)
+		if FromContext(r.Context()) != regenerated || regenerated.SessionID(nil) == oldsid {
+			t.Fatal("regenerated session is not in the request context")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	handler = manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		manager.SessionDestroy(w, r)
+		if FromContext(r.Context()) != nil {
+			t.Fatal("destroyed session is still in the request context")
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+// plainWriter implements neither http.Flusher nor http.Hijacker
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestMiddlewareWriterInterfaces(t *testing.T) {
+	manager, err := NewManager("cookie", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgProviderConfig(`{"cookieName":"bsessionid","securityKey":"bhojpurcookiehashkey"}`),
+	))
+	if err != nil {
+		t.Fatal("init cookie session err", err)
+	}
+
+	for _, w := range []http.ResponseWriter{httptest.NewRecorder(), plainWriter{httptest.NewRecorder()}} {
+		_, flusher := w.(http.Flusher)
+		_, hijacker := w.(http.Hijacker)
+		handler := manager.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := w.(http.Flusher); ok != flusher {
+				t.Errorf("%T: wrapped writer implements http.Flusher: %v", w, ok)
+			}
+			if _, ok := w.(http.Hijacker); ok != hijacker {
+				t.Errorf("%T: wrapped writer implements http.Hijacker: %v", w, ok)
+			}
+		}))
+		r, _ := http.NewRequest("GET", "/", nil)
+		handler.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,193 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Serializer converts session values to and from the bytes stored by a provider
+type Serializer interface {
+	Serialize(values map[interface{}]interface{}) ([]byte, error)
+	Deserialize(data []byte) (map[interface{}]interface{}, error)
+}
+
+// SerializerSetter is implemented by providers which store serialized
+// session values. NewManager passes the configured serializer, wrapped by
+// CompressSerializer and EncryptSerializer, before the provider is initialised.
+type SerializerSetter interface {
+	SetSerializer(serializer Serializer)
+}
+
+var serializers = map[string]Serializer{
+	"gob":     GobSerializer{},
+	"json":    JSONSerializer{},
+	"msgpack": MsgpackSerializer{},
+	"cbor":    CBORSerializer{},
+}
+
+// RegisterSerializer makes a serializer available by the provided name.
+// If serializer is nil, it panic
+func RegisterSerializer(name string, serializer Serializer) {
+	if serializer == nil {
+		panic("session: RegisterSerializer serializer is nil")
+	}
+	serializers[name] = serializer
+}
+
+// GetSerializer return the serializer registered with name
+func GetSerializer(name string) (Serializer, error) {
+	serializer, ok := serializers[name]
+	if !ok {
+		return nil, fmt.Errorf("session: unknown serializer %q", name)
+	}
+	return serializer, nil
+}
+
+// ProviderSerializer is embedded by providers to implement SerializerSetter.
+// Without a serializer set it uses gob.
+type ProviderSerializer struct {
+	serializer Serializer
+}
+
+// SetSerializer set the serializer of session values
+func (p *ProviderSerializer) SetSerializer(serializer Serializer) {
+	p.serializer = serializer
+}
+
+// Serializer return the serializer of session values
+func (p *ProviderSerializer) Serializer() Serializer {
+	if p.serializer == nil {
+		return GobSerializer{}
+	}
+	return p.serializer
+}
+
+// GobSerializer stores session values as gob. Custom types must be registered
+// with gob.Register before sessions containing them are read.
+type GobSerializer struct{}
+
+// Serialize encode values to gob
+func (GobSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	return EncodeGob(values)
+}
+
+// Deserialize decode values from gob
+func (GobSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	return DecodeGob(data)
+}
+
+// JSONSerializer stores session values as a JSON object, so that they can be
+// read by services written in other languages. Keys are stored as strings,
+// numbers are read as float64 and objects as map[string]interface{}.
+type JSONSerializer struct{}
+
+// Serialize encode values to JSON
+func (JSONSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	return json.Marshal(jsonValue(values))
+}
+
+// Deserialize decode values from JSON
+func (JSONSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	var obj map[string]interface{}
+	err := json.Unmarshal(data, &obj)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[interface{}]interface{}, len(obj))
+	for k, v := range obj {
+		values[k] = v
+	}
+	return values, nil
+}
+
+// jsonValue converts maps with non-string keys, which encoding/json cannot
+// encode, to maps with string keys
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = jsonValue(e)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = jsonValue(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = jsonValue(e)
+		}
+		return s
+	default:
+		return v
+	}
+}
+
+// MsgpackSerializer stores session values as MessagePack
+type MsgpackSerializer struct{}
+
+// Serialize encode values to MessagePack
+func (MsgpackSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	return msgpack.Marshal(values)
+}
+
+// Deserialize decode values from MessagePack
+func (MsgpackSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	var values map[interface{}]interface{}
+	err := msgpack.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = make(map[interface{}]interface{})
+	}
+	return values, nil
+}
+
+// CBORSerializer stores session values as CBOR (RFC 8949)
+type CBORSerializer struct{}
+
+// Serialize encode values to CBOR
+func (CBORSerializer) Serialize(values map[interface{}]interface{}) ([]byte, error) {
+	return cbor.Marshal(values)
+}
+
+// Deserialize decode values from CBOR
+func (CBORSerializer) Deserialize(data []byte) (map[interface{}]interface{}, error) {
+	var values map[interface{}]interface{}
+	err := cbor.Unmarshal(data, &values)
+	if err != nil {
+		return nil, err
+	}
+	if values == nil {
+		values = make(map[interface{}]interface{})
+	}
+	return values, nil
+}
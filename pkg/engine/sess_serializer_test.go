@@ -0,0 +1,120 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestSerializers(t *testing.T) {
+	values := map[interface{}]interface{}{
+		"username": "bhojpur",
+		"roles":    []interface{}{"admin", "user"},
+		"profile":  map[string]interface{}{"lang": "hi"},
+	}
+
+	for _, name := range []string{"gob", "json", "msgpack", "cbor"} {
+		serializer, err := GetSerializer(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := serializer.Serialize(values)
+		if err != nil {
+			t.Fatalf("%s: serialize failed: %v", name, err)
+		}
+		dst, err := serializer.Deserialize(b)
+		if err != nil {
+			t.Fatalf("%s: deserialize failed: %v", name, err)
+		}
+		if dst["username"] != "bhojpur" {
+			t.Errorf("%s: expected username bhojpur, got %v", name, dst["username"])
+		}
+		if !reflect.DeepEqual(dst["roles"], values["roles"]) {
+			t.Errorf("%s: expected roles %v, got %v", name, values["roles"], dst["roles"])
+		}
+		if profile := reflect.ValueOf(dst["profile"]); profile.Kind() != reflect.Map || profile.Len() != 1 {
+			t.Errorf("%s: expected profile map, got %v", name, dst["profile"])
+		}
+	}
+
+	if _, err := GetSerializer("xml"); err == nil {
+		t.Error("expected error for unknown serializer")
+	}
+}
+
+func TestJSONSerializerKeys(t *testing.T) {
+	b, err := JSONSerializer{}.Serialize(map[interface{}]interface{}{
+		12:     "twelve",
+		"cart": map[interface{}]interface{}{1: "item"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"12":"twelve","cart":{"1":"item"}}` {
+		t.Fatal("unexpected JSON", string(b))
+	}
+}
+
+func TestManagerSerializer(t *testing.T) {
+	_, err := NewManager("file", NewManagerConfig(CfgSerializerName("xml")))
+	if err == nil {
+		t.Fatal("expected error for unknown serializer")
+	}
+
+	sessionPath := path.Join(os.TempDir(), "bhojpur_session_serializer_test")
+	os.RemoveAll(sessionPath)
+	defer os.RemoveAll(sessionPath)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	manager, err := NewManager("file", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgProviderConfig(sessionPath),
+		CfgSerializerName("json"),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	defer filepder.SetSerializer(nil)
+
+	store, err := manager.GetProvider().SessionRead(context.Background(), "abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Set(nil, "username", "bhojpur")
+	if err = store.SessionRelease(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path.Join(sessionPath, "a", "b", "abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"username":"bhojpur"}` {
+		t.Fatal("expected session stored as JSON, got", string(b))
+	}
+}
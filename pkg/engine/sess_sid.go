@@ -0,0 +1,245 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SidExtractor reads the session ID of a request. It returns an empty ID if
+// the request carries none.
+type SidExtractor interface {
+	ExtractSid(r *http.Request) (string, error)
+}
+
+// SidWriter passes the session ID of a request to the client. sid is empty
+// once the session was destroyed. Writers also set the ID in r, so that the
+// session is found again while the request is served.
+type SidWriter interface {
+	WriteSid(w http.ResponseWriter, r *http.Request, sid string)
+}
+
+// SidLifetimeWriter is implemented by writers which pass the lifetime of the
+// session to the client, see SetLifetime. It is called on release for
+// sessions with their own lifetime.
+type SidLifetimeWriter interface {
+	WriteSidLifetime(w http.ResponseWriter, r *http.Request, sid string, lifetime time.Duration)
+}
+
+// SidExtractorFunc is a function used as SidExtractor
+type SidExtractorFunc func(r *http.Request) (string, error)
+
+// ExtractSid calls f(r)
+func (f SidExtractorFunc) ExtractSid(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// SidWriterFunc is a function used as SidWriter
+type SidWriterFunc func(w http.ResponseWriter, r *http.Request, sid string)
+
+// WriteSid calls f(w, r, sid)
+func (f SidWriterFunc) WriteSid(w http.ResponseWriter, r *http.Request, sid string) {
+	f(w, r, sid)
+}
+
+// SetSidExtractors sets the extractors asked for the session ID of requests,
+// the first ID found is used. By default the cookie is read, followed by the
+// query (EnableSidInURLQuery) and the header (EnableSidInHTTPHeader).
+func (manager *Manager) SetSidExtractors(extractors ...SidExtractor) {
+	manager.extractors = extractors
+}
+
+// SetSidWriters sets the writers which pass the ID of new, regenerated and
+// destroyed sessions to the client. By default the cookie is written,
+// followed by the header (EnableSidInHTTPHeader).
+func (manager *Manager) SetSidWriters(writers ...SidWriter) {
+	manager.writers = writers
+}
+
+// defaultSidTransports returns the extractors and writers of the config
+func (manager *Manager) defaultSidTransports() ([]SidExtractor, []SidWriter) {
+	extractors := []SidExtractor{manager.CookieSid()}
+	writers := []SidWriter{manager.CookieSid()}
+	if manager.config.EnableSidInURLQuery {
+		extractors = append(extractors, QuerySid(manager.config.CookieName))
+	}
+	if manager.config.EnableSidInHTTPHeader {
+		extractors = append(extractors, HeaderSid(manager.config.SessionNameInHTTPHeader))
+		writers = append(writers, HeaderSid(manager.config.SessionNameInHTTPHeader))
+	}
+	return extractors, writers
+}
+
+// getSid returns the session ID of the first extractor which finds one, or
+// an empty ID to start a new session.
+func (manager *Manager) getSid(r *http.Request) (string, error) {
+	for _, extractor := range manager.extractors {
+		sid, err := extractor.ExtractSid(r)
+		if err != nil || sid != "" {
+			return sid, err
+		}
+	}
+	return "", nil
+}
+
+// writeSid passes sid to all writers
+func (manager *Manager) writeSid(w http.ResponseWriter, r *http.Request, sid string) {
+	for _, writer := range manager.writers {
+		writer.WriteSid(w, r, sid)
+	}
+}
+
+// writeLifetime passes the lifetime of session to the writers which support it
+func (manager *Manager) writeLifetime(ctx context.Context, w http.ResponseWriter, session Store) {
+	lifetime, err := Lifetime(ctx, session)
+	if err != nil || lifetime <= 0 {
+		return
+	}
+	r := RequestFromContext(ctx)
+	if r == nil {
+		// released without the context of SessionStart
+		r = &http.Request{URL: &url.URL{}, Header: make(http.Header)}
+	}
+	for _, writer := range manager.writers {
+		if writer, ok := writer.(SidLifetimeWriter); ok {
+			writer.WriteSidLifetime(w, r, session.SessionID(ctx), lifetime)
+		}
+	}
+}
+
+// CookieSid reads and writes the session ID in the cookie CookieName with the
+// cookie settings of the manager. Cookies are only sent to the client with
+// EnableSetCookie.
+type CookieSid struct {
+	manager *Manager
+}
+
+// CookieSid returns the cookie transport of the session ID
+func (manager *Manager) CookieSid() CookieSid {
+	return CookieSid{manager: manager}
+}
+
+// ExtractSid implements SidExtractor
+func (c CookieSid) ExtractSid(r *http.Request) (string, error) {
+	cookie, err := r.Cookie(c.manager.config.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", nil
+	}
+	return url.QueryUnescape(cookie.Value)
+}
+
+// WriteSid implements SidWriter
+func (c CookieSid) WriteSid(w http.ResponseWriter, r *http.Request, sid string) {
+	c.write(w, r, sid, c.manager.config.CookieLifeTime)
+}
+
+// WriteSidLifetime implements SidLifetimeWriter, the cookie expires with the
+// session
+func (c CookieSid) WriteSidLifetime(w http.ResponseWriter, r *http.Request, sid string, lifetime time.Duration) {
+	c.write(w, r, sid, int(lifetime/time.Second))
+}
+
+// write the cookie with sid which expires after maxAge seconds, or with the
+// browser session if maxAge is 0
+func (c CookieSid) write(w http.ResponseWriter, r *http.Request, sid string, maxAge int) {
+	config := c.manager.config
+	cookie := &http.Cookie{
+		Name:     config.CookieName,
+		Value:    url.QueryEscape(sid),
+		Path:     "/",
+		HttpOnly: !config.DisableHTTPOnly,
+		Secure:   c.manager.isSecure(r),
+		Domain:   config.Domain,
+		SameSite: config.CookieSameSite,
+	}
+	if sid == "" {
+		cookie.MaxAge = -1
+		cookie.Expires = time.Now()
+	} else if maxAge > 0 {
+		cookie.MaxAge = maxAge
+		cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+	if config.EnableSetCookie {
+		http.SetCookie(w, cookie)
+	}
+
+	// replace the cookie of the request
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, rc := range cookies {
+		if rc.Name != config.CookieName {
+			r.AddCookie(rc)
+		}
+	}
+	if sid != "" {
+		r.AddCookie(cookie)
+	}
+}
+
+// HeaderSid reads and writes the session ID in the header of its name,
+// e.g. HeaderSid("X-Session-Id")
+type HeaderSid string
+
+// ExtractSid implements SidExtractor
+func (h HeaderSid) ExtractSid(r *http.Request) (string, error) {
+	return r.Header.Get(string(h)), nil
+}
+
+// WriteSid implements SidWriter
+func (h HeaderSid) WriteSid(w http.ResponseWriter, r *http.Request, sid string) {
+	if sid == "" {
+		r.Header.Del(string(h))
+		w.Header().Del(string(h))
+		return
+	}
+	r.Header.Set(string(h), sid)
+	w.Header().Set(string(h), sid)
+}
+
+// QuerySid reads the session ID from the query parameter or form value of
+// its name
+type QuerySid string
+
+// ExtractSid implements SidExtractor
+func (q QuerySid) ExtractSid(r *http.Request) (string, error) {
+	if err := r.ParseForm(); err != nil {
+		return "", err
+	}
+	return r.FormValue(string(q)), nil
+}
+
+// BearerSid reads the session ID from the bearer token of the Authorization
+// header, as sent by API clients
+type BearerSid struct{}
+
+// ExtractSid implements SidExtractor
+func (BearerSid) ExtractSid(r *http.Request) (string, error) {
+	const prefix = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len(prefix) || !strings.EqualFold(auth[:len(prefix)], prefix) {
+		return "", nil
+	}
+	return strings.TrimSpace(auth[len(prefix):]), nil
+}
@@ -0,0 +1,112 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSidExtractors(t *testing.T) {
+	r, _ := http.NewRequest("GET", "/?sid=query", nil)
+	r.Header.Set("Authorization", "bearer token")
+	r.Header.Set("X-Session-Id", "header")
+
+	for _, test := range []struct {
+		extractor SidExtractor
+		want      string
+	}{
+		{QuerySid("sid"), "query"},
+		{QuerySid("other"), ""},
+		{BearerSid{}, "token"},
+		{HeaderSid("X-Session-Id"), "header"},
+		{HeaderSid("X-Other-Id"), ""},
+		{SidExtractorFunc(func(*http.Request) (string, error) { return "func", nil }), "func"},
+	} {
+		if sid, err := test.extractor.ExtractSid(r); err != nil || sid != test.want {
+			t.Fatalf("%T: got %q, %v, want %q", test.extractor, sid, err, test.want)
+		}
+	}
+
+	r.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if sid, _ := (BearerSid{}).ExtractSid(r); sid != "" {
+		t.Fatal("expected no bearer token, got", sid)
+	}
+}
+
+func TestManagerSidTransports(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgSetCookie(true),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	manager.SetSidExtractors(manager.CookieSid(), BearerSid{})
+	manager.SetSidWriters(manager.CookieSid(), HeaderSid("X-Session-Id"))
+
+	// API clients get the ID in the header and send it as bearer token
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	sess, err := manager.SessionStart(w, r)
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	sid := w.Header().Get("X-Session-Id")
+	if sid != sess.SessionID(nil) || w.Header().Get("Set-Cookie") == "" {
+		t.Fatal("session ID was not written:", w.Header())
+	}
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+sid)
+	if sess, _ = manager.SessionStart(httptest.NewRecorder(), r); sess.SessionID(nil) != sid {
+		t.Fatal("bearer token was not used")
+	}
+
+	// the regenerated ID replaces the cookie of the request
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "bsessionid", Value: sid})
+	r.AddCookie(&http.Cookie{Name: "other", Value: "kept"})
+	regenerated, err := manager.SessionRegenerateID(w, r)
+	if err != nil {
+		t.Fatal("regenerate failed:", err)
+	}
+	if regenerated.SessionID(nil) == sid || w.Header().Get("X-Session-Id") != regenerated.SessionID(nil) {
+		t.Fatal("regenerated ID was not written:", w.Header())
+	}
+	if sess, _ = manager.SessionStart(w, r); sess.SessionID(nil) != regenerated.SessionID(nil) {
+		t.Fatal("regenerated session is not started again")
+	}
+	if c, err := r.Cookie("other"); err != nil || c.Value != "kept" {
+		t.Fatal("other cookies of the request were lost")
+	}
+
+	w = httptest.NewRecorder()
+	manager.SessionDestroy(w, r)
+	if w.Header().Get("X-Session-Id") != "" {
+		t.Fatal("header of destroyed session was written")
+	}
+	if _, err = r.Cookie("bsessionid"); err != http.ErrNoCookie {
+		t.Fatal("cookie of destroyed session is still in the request")
+	}
+}
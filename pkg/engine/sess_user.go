@@ -0,0 +1,273 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// UserKey holds the ID of the user a session belongs to, see SetSessionUser
+const UserKey = "bhojpur.session.user"
+
+// Policies for users who reach MaxUserSessions, see CfgUserSessionLimit
+const (
+	// RejectNewSession makes SetSessionUser return ErrSessionLimit, the default
+	RejectNewSession = "reject"
+	// EvictOldestSession makes SetSessionUser destroy the oldest sessions
+	// of the user
+	EvictOldestSession = "evictOldest"
+)
+
+// ErrNoUserIndex is returned by the user APIs of the manager when its
+// provider does not index sessions by user
+var ErrNoUserIndex = errors.New("session: provider does not index sessions by user")
+
+// ErrSessionLimit is returned by SetSessionUser when the user has
+// MaxUserSessions sessions already and new sessions are rejected
+var ErrSessionLimit = errors.New("session: user has too many sessions")
+
+// UserIndexer is implemented by providers which can find the sessions of a
+// user. The index may hold sessions which were destroyed or expired since,
+// the manager removes them when it lists the sessions of the user. Providers
+// which keep the user with the stored session, e.g. in a column, may move
+// it to the new ID in SessionRegenerate.
+type UserIndexer interface {
+	// SessionIndexUser adds sid, a session created at created, to the
+	// sessions of user. The session expires after lifetime, unless it's
+	// accessed again.
+	SessionIndexUser(ctx context.Context, user, sid string, created time.Time, lifetime time.Duration) error
+	// SessionUnindexUser removes sid from the sessions of user
+	SessionUnindexUser(ctx context.Context, user, sid string) error
+	// SessionsOfUser returns the IDs of the sessions of user, oldest first
+	SessionsOfUser(ctx context.Context, user string) ([]string, error)
+	// SessionUserIndexed reports whether sid is one of the sessions of user
+	SessionUserIndexed(ctx context.Context, user, sid string) (bool, error)
+}
+
+// SetSessionUser associates a session with a user, e.g. on login, so that
+// UserSessions and DestroyUserSessions find it. An empty user removes the
+// association, e.g. on logout. With MaxUserSessions, users who have as many
+// sessions already are rejected or their oldest sessions are evicted.
+// Sessions past the idle or absolute timeout are not counted. The limit only
+// counts sessions assigned to a user, it is checked here and not by
+// SessionStart or SessionRegenerateID, which keeps the user of a session.
+// It is not enforced atomically, concurrent logins may exceed it.
+func (manager *Manager) SetSessionUser(ctx context.Context, session Store, user string) error {
+	index, ok := manager.provider.(UserIndexer)
+	if !ok {
+		return ErrNoUserIndex
+	}
+	sid := session.SessionID(ctx)
+	previous, err := SessionUser(ctx, session)
+	if err != nil {
+		return err
+	}
+	if user != "" && user != previous {
+		if err = manager.limitUserSessions(ctx, index, user); err != nil {
+			return err
+		}
+	}
+	if previous != "" && previous != user {
+		if err = index.SessionUnindexUser(ctx, previous, sid); err != nil {
+			return err
+		}
+	}
+	if user == "" {
+		return session.Delete(ctx, UserKey)
+	}
+	if err = session.Set(ctx, UserKey, user); err != nil {
+		return err
+	}
+	return manager.indexUser(ctx, index, session, user)
+}
+
+// SessionUser returns the user a session belongs to, or ""
+func SessionUser(ctx context.Context, session Store) (string, error) {
+	v, err := session.Get(ctx, UserKey)
+	if err != nil {
+		return "", err
+	}
+	user, _ := v.(string)
+	return user, nil
+}
+
+// UserSessions returns the IDs of the existing sessions of user, oldest first
+func (manager *Manager) UserSessions(ctx context.Context, user string) ([]string, error) {
+	index, ok := manager.provider.(UserIndexer)
+	if !ok {
+		return nil, ErrNoUserIndex
+	}
+	sids, err := index.SessionsOfUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	existing := sids[:0]
+	for _, sid := range sids {
+		exists, err := manager.provider.SessionExist(ctx, sid)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			if err = index.SessionUnindexUser(ctx, user, sid); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		existing = append(existing, sid)
+	}
+	return existing, nil
+}
+
+// DestroyUserSessions destroys all sessions of user, e.g. after the password
+// was changed. Requests which hold one of the sessions at the same time may
+// still write it on release, but SessionStart does not accept it anymore.
+func (manager *Manager) DestroyUserSessions(ctx context.Context, user string) error {
+	index, ok := manager.provider.(UserIndexer)
+	if !ok {
+		return ErrNoUserIndex
+	}
+	sids, err := index.SessionsOfUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	return manager.destroyUserSessions(ctx, index, user, sids)
+}
+
+func (manager *Manager) destroyUserSessions(ctx context.Context, index UserIndexer, user string, sids []string) error {
+	for _, sid := range sids {
+		if err := manager.provider.SessionDestroy(ctx, sid); err != nil {
+			return err
+		}
+		if err := index.SessionUnindexUser(ctx, user, sid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitUserSessions makes room for one more session of user, see
+// MaxUserSessions. Sessions past the idle or absolute timeout are destroyed
+// and not counted.
+func (manager *Manager) limitUserSessions(ctx context.Context, index UserIndexer, user string) error {
+	max := manager.config.MaxUserSessions
+	if max <= 0 {
+		return nil
+	}
+	sids, err := manager.UserSessions(ctx, user)
+	if err != nil {
+		return err
+	}
+	var dead []string
+	live := sids[:0]
+	for _, sid := range sids {
+		session, err := manager.provider.SessionRead(ctx, sid)
+		if err != nil {
+			return err
+		}
+		expired, err := manager.expired(ctx, session)
+		if err != nil {
+			return err
+		}
+		if expired {
+			dead = append(dead, sid)
+		} else {
+			live = append(live, sid)
+		}
+	}
+	if err = manager.destroyUserSessions(ctx, index, user, dead); err != nil {
+		return err
+	}
+	sids = live
+	if len(sids) < max {
+		return nil
+	}
+	if manager.config.UserSessionPolicy != EvictOldestSession {
+		return ErrSessionLimit
+	}
+	return manager.destroyUserSessions(ctx, index, user, sids[:len(sids)-max+1])
+}
+
+// revoked reports whether a session of a user was removed from the index,
+// because all sessions of the user or the oldest ones were destroyed while
+// a request held it. The release of that request wrote it again.
+func (manager *Manager) revoked(ctx context.Context, session Store) (bool, error) {
+	index, ok := manager.provider.(UserIndexer)
+	if !ok {
+		return false, nil
+	}
+	user, err := SessionUser(ctx, session)
+	if err != nil || user == "" {
+		return false, err
+	}
+	indexed, err := index.SessionUserIndexed(ctx, user, session.SessionID(ctx))
+	return !indexed, err
+}
+
+// reindexUser moves a session of a user from oldsid to its new ID, unless
+// the session was revoked
+func (manager *Manager) reindexUser(ctx context.Context, oldsid string, session Store) (revoked bool, err error) {
+	index, ok := manager.provider.(UserIndexer)
+	if !ok {
+		return false, nil
+	}
+	user, err := SessionUser(ctx, session)
+	if err != nil || user == "" {
+		return false, err
+	}
+	indexed, err := index.SessionUserIndexed(ctx, user, oldsid)
+	if err != nil {
+		return true, err
+	}
+	if !indexed {
+		// the index moved with the session, unless it was revoked
+		indexed, err = index.SessionUserIndexed(ctx, user, session.SessionID(ctx))
+		return !indexed, err
+	}
+	if err = index.SessionUnindexUser(ctx, user, oldsid); err != nil {
+		return false, err
+	}
+	return false, manager.indexUser(ctx, index, session, user)
+}
+
+// indexUser indexes session for as long as the provider keeps it. Sessions
+// without a creation time are created now, so that they keep their age when
+// they are regenerated.
+func (manager *Manager) indexUser(ctx context.Context, index UserIndexer, session Store, user string) error {
+	created, ok, err := storedTime(ctx, session, CreatedKey)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		created = time.Now().Unix()
+		if err = session.Set(ctx, CreatedKey, created); err != nil {
+			return err
+		}
+	}
+	lifetime, err := Lifetime(ctx, session)
+	if err != nil {
+		return err
+	}
+	if lifetime <= 0 {
+		lifetime = time.Duration(manager.config.Maxlifetime) * time.Second
+	}
+	return index.SessionIndexUser(ctx, user, session.SessionID(ctx), time.Unix(created, 0), lifetime)
+}
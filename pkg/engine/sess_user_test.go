@@ -0,0 +1,263 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestUserSessions(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	ctx := context.Background()
+
+	var sids []string
+	for i := 0; i < 3; i++ {
+		sess, err := manager.SessionRegenerateWithID(ctx, "")
+		if err != nil {
+			t.Fatal("session start failed:", err)
+		}
+		if i < 2 {
+			if err = manager.SetSessionUser(ctx, sess, "alice"); err != nil {
+				t.Fatal("set user failed:", err)
+			}
+		}
+		sids = append(sids, sess.SessionID(ctx))
+	}
+	if user, _ := SessionUser(ctx, mustRead(t, manager, sids[0])); user != "alice" {
+		t.Fatal("unexpected user of session", user)
+	}
+
+	// a regenerated session keeps its user with the new ID
+	sess, err := manager.SessionRegenerateWithID(ctx, sids[1])
+	if err != nil {
+		t.Fatal("regenerate failed:", err)
+	}
+	sids[1] = sess.SessionID(ctx)
+	got, err := manager.UserSessions(ctx, "alice")
+	if err != nil {
+		t.Fatal("user sessions failed:", err)
+	}
+	want := []string{sids[0], sids[1]}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Fatal("unexpected sessions of user", got, want)
+	}
+	index := manager.GetProvider().(UserIndexer)
+	if indexed, _ := index.SessionUserIndexed(ctx, "alice", sids[1]); !indexed {
+		t.Fatal("session of user is not indexed")
+	}
+	if indexed, _ := index.SessionUserIndexed(ctx, "alice", sids[2]); indexed {
+		t.Fatal("session without user is indexed")
+	}
+
+	if err = manager.DestroyUserSessions(ctx, "alice"); err != nil {
+		t.Fatal("destroy user sessions failed:", err)
+	}
+	for i, sid := range sids {
+		exists, _ := manager.GetProvider().SessionExist(ctx, sid)
+		if exists != (i == 2) {
+			t.Fatalf("session %d exists: %v", i, exists)
+		}
+	}
+	if got, _ = manager.UserSessions(ctx, "alice"); len(got) != 0 {
+		t.Fatal("unexpected sessions of user", got)
+	}
+	manager.SessionDestroyWithID(ctx, sids[2])
+}
+
+func TestUserSessionLimit(t *testing.T) {
+	for _, policy := range []string{RejectNewSession, EvictOldestSession} {
+		manager, err := NewManager("memory", NewManagerConfig(
+			CfgCookieName("bsessionid"),
+			CfgGcLifeTime(3600),
+			CfgUserSessionLimit(2, policy),
+		))
+		if err != nil {
+			t.Fatal("could not create manager:", err)
+		}
+		ctx := context.Background()
+		user := "bob-" + policy
+
+		var sids []string
+		for i := 0; i < 3; i++ {
+			sess, err := manager.SessionRegenerateWithID(ctx, "")
+			if err != nil {
+				t.Fatal("session start failed:", err)
+			}
+			// the first session is the oldest
+			sess.Set(ctx, CreatedKey, time.Now().Add(time.Duration(i-3)*time.Hour).Unix())
+			err = manager.SetSessionUser(ctx, sess, user)
+			if i == 2 && policy == RejectNewSession {
+				if err != ErrSessionLimit {
+					t.Fatal("session over the limit was not rejected:", err)
+				}
+				manager.SessionDestroyWithID(ctx, sess.SessionID(ctx))
+				continue
+			}
+			if err != nil {
+				t.Fatal("set user failed:", err)
+			}
+			sids = append(sids, sess.SessionID(ctx))
+		}
+		got, _ := manager.UserSessions(ctx, user)
+		want := sids[len(sids)-2:]
+		if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Fatalf("unexpected sessions with %s: %v, want %v", policy, got, want)
+		}
+		manager.DestroyUserSessions(ctx, user)
+	}
+
+	if _, err := NewManager("memory", NewManagerConfig(CfgUserSessionLimit(1, "random"))); err == nil {
+		t.Fatal("unknown policy was accepted")
+	}
+}
+
+func TestUserSessionLimitExpired(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+		CfgExpiration(3600, 0),
+		CfgUserSessionLimit(1, RejectNewSession),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	ctx := context.Background()
+	idle, _ := manager.SessionRegenerateWithID(ctx, "")
+	if err = manager.SetSessionUser(ctx, idle, "erin"); err != nil {
+		t.Fatal("set user failed:", err)
+	}
+	// abandoned longer than the idle timeout, but not collected yet
+	idle.Set(ctx, AccessedKey, time.Now().Add(-2*time.Hour).Unix())
+
+	sess, _ := manager.SessionRegenerateWithID(ctx, "")
+	if err = manager.SetSessionUser(ctx, sess, "erin"); err != nil {
+		t.Fatal("expired session counted against the limit:", err)
+	}
+	if exists, _ := manager.GetProvider().SessionExist(ctx, idle.SessionID(ctx)); exists {
+		t.Fatal("expired session was not destroyed")
+	}
+	if sids, _ := manager.UserSessions(ctx, "erin"); len(sids) != 1 || sids[0] != sess.SessionID(ctx) {
+		t.Fatal("unexpected sessions of user", sids)
+	}
+	manager.DestroyUserSessions(ctx, "erin")
+}
+
+func TestRevokedSession(t *testing.T) {
+	manager, err := NewManager("memory", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	ctx := context.Background()
+	sess, _ := manager.SessionRegenerateWithID(ctx, "")
+	if err = manager.SetSessionUser(ctx, sess, "carol"); err != nil {
+		t.Fatal("set user failed:", err)
+	}
+	sid := sess.SessionID(ctx)
+
+	// as if the session was written again after it was destroyed
+	mempder.SessionUnindexUser(ctx, "carol", sid)
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: "bsessionid", Value: sid})
+	if sess, err = manager.SessionStart(httptest.NewRecorder(), r); err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	if sess.SessionID(ctx) == sid {
+		t.Fatal("revoked session was accepted")
+	}
+	if user, _ := SessionUser(ctx, sess); user != "" {
+		t.Fatal("new session has a user", user)
+	}
+	manager.SessionDestroyWithID(ctx, sess.SessionID(ctx))
+}
+
+// rowIndexProvider moves the user of a session with it on regenerate, like
+// the SQL providers which keep it in a column of the session row
+type rowIndexProvider struct {
+	*MemProvider
+}
+
+func (p *rowIndexProvider) SessionRegenerate(ctx context.Context, oldsid, sid string) (Store, error) {
+	p.lock.Lock()
+	for _, sids := range p.users {
+		if created, ok := sids[oldsid]; ok {
+			delete(sids, oldsid)
+			sids[sid] = created
+		}
+	}
+	p.lock.Unlock()
+	return p.MemProvider.SessionRegenerate(ctx, oldsid, sid)
+}
+
+func TestRegenerateMovedIndex(t *testing.T) {
+	Register("rowindex", &rowIndexProvider{&MemProvider{list: list.New(), sessions: make(map[string]*list.Element)}})
+	manager, err := NewManager("rowindex", NewManagerConfig(
+		CfgCookieName("bsessionid"),
+		CfgGcLifeTime(3600),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	ctx := context.Background()
+	sess, _ := manager.SessionRegenerateWithID(ctx, "")
+	if err = manager.SetSessionUser(ctx, sess, "dave"); err != nil {
+		t.Fatal("set user failed:", err)
+	}
+	sid := sess.SessionID(ctx)
+
+	if sess, err = manager.SessionRegenerateWithID(ctx, sid); err != nil {
+		t.Fatal("regenerate failed:", err)
+	}
+	if sess.SessionID(ctx) == sid {
+		t.Fatal("session ID was not regenerated")
+	}
+	if user, _ := SessionUser(ctx, sess); user != "dave" {
+		t.Fatal("regenerated session lost its user", user)
+	}
+	if sids, _ := manager.UserSessions(ctx, "dave"); len(sids) != 1 || sids[0] != sess.SessionID(ctx) {
+		t.Fatal("unexpected sessions of user", sids)
+	}
+	manager.SessionDestroyWithID(ctx, sess.SessionID(ctx))
+}
+
+func mustRead(t *testing.T, manager *Manager, sid string) Store {
+	sess, err := manager.GetSessionStore(sid)
+	if err != nil {
+		t.Fatal("session read failed:", err)
+	}
+	return sess
+}
@@ -22,20 +22,25 @@ package engine
 
 import (
 	"bytes"
+	"context"
+	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/binary"
 	"encoding/gob"
 	"errors"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bhojpur/token/pkg/utils"
+	"golang.org/x/crypto/hkdf"
 )
 
 func init() {
@@ -84,6 +89,35 @@ func generateRandomKey(strength int) []byte {
 	return k
 }
 
+// RunWithContext runs fn for providers whose client library has no context
+// support. It returns the context's error as soon as ctx is done, even when
+// fn is still running, and does not run fn at all if ctx is already done. A
+// nil ctx never cancels fn. Since fn may outlive the call, fn must serialize
+// its own use of clients which are not safe for concurrent use.
+func RunWithContext(ctx context.Context, fn func() error) error {
+	if ctx == nil {
+		return fn()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if ctx.Done() == nil {
+		// ctx can never be cancelled
+		return fn()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Encryption -----------------------------------------------------------------
 
 // encrypt encrypts a value using the given block in counter mode.
@@ -121,11 +155,11 @@ func decrypt(block cipher.Block, value []byte) ([]byte, error) {
 	return nil, errors.New("decrypt: the value could not be decrypted")
 }
 
-func encodeCookie(block cipher.Block, hashKey, name string, value map[interface{}]interface{}) (string, error) {
+func encodeCookie(block cipher.Block, hashKey, name string, serializer Serializer, value map[interface{}]interface{}) (string, error) {
 	var err error
 	var b []byte
-	// 1. EncodeGob.
-	if b, err = EncodeGob(value); err != nil {
+	// 1. Serialize.
+	if b, err = serializer.Serialize(value); err != nil {
 		return "", err
 	}
 	// 2. Encrypt (optional).
@@ -146,7 +180,7 @@ func encodeCookie(block cipher.Block, hashKey, name string, value map[interface{
 	return string(b), nil
 }
 
-func decodeCookie(block cipher.Block, hashKey, name, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
+func decodeCookie(block cipher.Block, hashKey, name string, serializer Serializer, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
 	// 1. Decode from base64.
 	b, err := decode([]byte(value))
 	if err != nil {
@@ -174,9 +208,6 @@ func decodeCookie(block cipher.Block, hashKey, name, value string, gcmaxlifetime
 	if t1 > t2 {
 		return nil, errors.New("Decode: timestamp is too new")
 	}
-	if t1 < t2-gcmaxlifetime {
-		return nil, errors.New("Decode: expired timestamp")
-	}
 	// 4. Decrypt (optional).
 	b, err = decode(parts[1])
 	if err != nil {
@@ -185,14 +216,99 @@ func decodeCookie(block cipher.Block, hashKey, name, value string, gcmaxlifetime
 	if b, err = decrypt(block, b); err != nil {
 		return nil, err
 	}
-	// 5. DecodeGob.
-	dst, err := DecodeGob(b)
+	// 5. Deserialize.
+	dst, err := serializer.Deserialize(b)
 	if err != nil {
 		return nil, err
 	}
+	// 6. Verify the lifetime, which can be set per session.
+	if t1 < t2-ValuesLifetime(dst, gcmaxlifetime) {
+		return nil, errors.New("Decode: expired timestamp")
+	}
 	return dst, nil
 }
 
+// aeadCookiePrefix marks cookies encoded by encodeCookieAEAD. Cookies without
+// it use the legacy "date|value|mac" format of encodeCookie.
+const aeadCookiePrefix = "v2."
+
+// newCookieAEAD derives an AES-256-GCM key from securityKey with HKDF-SHA256,
+// so that every process configured with the same key can read the cookies.
+func newCookieAEAD(securityKey string) (cipher.AEAD, error) {
+	if securityKey == "" {
+		return nil, errors.New("session: securityKey is required for aead cookies")
+	}
+	return newAEAD(securityKey, "bhojpur session cookie v2")
+}
+
+// newAEAD derives an AES-256-GCM key for the given purpose from secret
+func newAEAD(secret, info string) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, []byte(secret), nil, []byte(info))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encodeCookieAEAD serializes and seals value. The cookie is "v2." followed by
+// base64 of "date|nonce|ciphertext", where the date is a big endian unix time.
+// The cookie name and date are authenticated as additional data.
+func encodeCookieAEAD(aead cipher.AEAD, name string, serializer Serializer, value map[interface{}]interface{}) (string, error) {
+	b, err := serializer.Serialize(value)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	date := make([]byte, 8)
+	binary.BigEndian.PutUint64(date, uint64(time.Now().UTC().Unix()))
+	out := append(date, nonce...)
+	out = aead.Seal(out, nonce, b, cookieAdditionalData(name, date))
+	return aeadCookiePrefix + base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+func decodeCookieAEAD(aead cipher.AEAD, name string, serializer Serializer, value string, gcmaxlifetime int64) (map[interface{}]interface{}, error) {
+	if !strings.HasPrefix(value, aeadCookiePrefix) {
+		return nil, errors.New("Decode: unknown cookie version")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(value[len(aeadCookiePrefix):])
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 8+aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("Decode: invalid value format")
+	}
+	date, nonce, ciphertext := b[:8], b[8:8+aead.NonceSize()], b[8+aead.NonceSize():]
+	if b, err = aead.Open(nil, nonce, ciphertext, cookieAdditionalData(name, date)); err != nil {
+		return nil, errors.New("Decode: the value is not valid")
+	}
+	t1 := int64(binary.BigEndian.Uint64(date))
+	t2 := time.Now().UTC().Unix()
+	if t1 > t2 {
+		return nil, errors.New("Decode: timestamp is too new")
+	}
+	dst, err := serializer.Deserialize(b)
+	if err != nil {
+		return nil, err
+	}
+	// the lifetime can be set per session
+	if t1 < t2-ValuesLifetime(dst, gcmaxlifetime) {
+		return nil, errors.New("Decode: expired timestamp")
+	}
+	return dst, nil
+}
+
+func cookieAdditionalData(name string, date []byte) []byte {
+	return append([]byte(aeadCookiePrefix+name+"|"), date...)
+}
+
 // Encoding -------------------------------------------------------------------
 
 // encode encodes a value using base64.
@@ -0,0 +1,74 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ErrSessionConflict is returned by SessionRelease when version checks are
+// enabled and the session was changed by another request since it was read.
+// The application can start the session again and retry or merge its changes.
+var ErrSessionConflict = errors.New("session: session was changed by another request")
+
+// VersionChecker is implemented by providers which can compare the version of
+// a session on release. NewManager enables the check with EnableVersionCheck.
+type VersionChecker interface {
+	SetVersionCheck(enabled bool)
+}
+
+// ProviderVersionCheck is embedded by providers to implement VersionChecker
+type ProviderVersionCheck struct {
+	enabled bool
+}
+
+// SetVersionCheck enable or disable version checks on release
+func (p *ProviderVersionCheck) SetVersionCheck(enabled bool) {
+	p.enabled = enabled
+}
+
+// VersionCheck return whether version checks are enabled
+func (p *ProviderVersionCheck) VersionCheck() bool {
+	return p.enabled
+}
+
+// versionedPayloadID follows compressionHeader in payloads with a version.
+// It is one of the IDs reserved for built-in compressors.
+const versionedPayloadID = 0x0e
+
+// EncodeVersion prepends version to a serialized session, for providers
+// which have no other place to store it
+func EncodeVersion(version uint64, data []byte) []byte {
+	b := make([]byte, 10, 10+len(data))
+	b[0], b[1] = compressionHeader, versionedPayloadID
+	binary.BigEndian.PutUint64(b[2:], version)
+	return append(b, data...)
+}
+
+// DecodeVersion splits data written by EncodeVersion into the version and
+// the serialized session. Data without a version has version 0.
+func DecodeVersion(data []byte) (uint64, []byte) {
+	if len(data) < 10 || data[0] != compressionHeader || data[1] != versionedPayloadID {
+		return 0, data
+	}
+	return binary.BigEndian.Uint64(data[2:10]), data[10:]
+}
@@ -0,0 +1,51 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeVersion(t *testing.T) {
+	data := []byte("serialized session")
+	version, decoded := DecodeVersion(EncodeVersion(42, data))
+	if version != 42 || !bytes.Equal(decoded, data) {
+		t.Fatalf("got version %d and %q", version, decoded)
+	}
+
+	// payloads written without version checks have version 0
+	for _, payload := range [][]byte{data, nil, {compressionHeader, GzipCompressor{}.ID(), 1}} {
+		version, decoded = DecodeVersion(payload)
+		if version != 0 || !bytes.Equal(decoded, payload) {
+			t.Fatalf("got version %d and %q for %q", version, decoded, payload)
+		}
+	}
+}
+
+func TestManagerVersionCheck(t *testing.T) {
+	if _, err := NewManager("memory", NewManagerConfig(CfgVersionCheck(true))); err == nil {
+		t.Fatal("expected error for provider without version checks")
+	}
+	if _, err := NewManager("memory", NewManagerConfig(CfgVersionCheck(false))); err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+}
@@ -1,26 +1,50 @@
 package engine
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
 
 // ManagerConfig define the session config
 type ManagerConfig struct {
-	EnableSetCookie         bool          `json:"enableSetCookie,omitempty"`
-	DisableHTTPOnly         bool          `json:"disableHTTPOnly"`
-	Secure                  bool          `json:"secure"`
-	EnableSidInHTTPHeader   bool          `json:"EnableSidInHTTPHeader"`
-	EnableSidInURLQuery     bool          `json:"EnableSidInURLQuery"`
-	CookieName              string        `json:"cookieName"`
-	Gclifetime              int64         `json:"gclifetime"`
-	Maxlifetime             int64         `json:"maxLifetime"`
-	CookieLifeTime          int           `json:"cookieLifeTime"`
-	ProviderConfig          string        `json:"providerConfig"`
-	Domain                  string        `json:"domain"`
-	SessionIDLength         int64         `json:"sessionIDLength"`
-	SessionNameInHTTPHeader string        `json:"SessionNameInHTTPHeader"`
-	SessionIDPrefix         string        `json:"sessionIDPrefix"`
-	CookieSameSite          http.SameSite `json:"cookieSameSite"`
+	EnableSetCookie         bool            `json:"enableSetCookie,omitempty"`
+	DisableHTTPOnly         bool            `json:"disableHTTPOnly"`
+	Secure                  bool            `json:"secure"`
+	EnableSidInHTTPHeader   bool            `json:"EnableSidInHTTPHeader"`
+	EnableSidInURLQuery     bool            `json:"EnableSidInURLQuery"`
+	CookieName              string          `json:"cookieName"`
+	Gclifetime              int64           `json:"gclifetime"`
+	Maxlifetime             int64           `json:"maxLifetime"`
+	CookieLifeTime          int             `json:"cookieLifeTime"`
+	ProviderConfig          string          `json:"providerConfig"`
+	Domain                  string          `json:"domain"`
+	SessionIDLength         int64           `json:"sessionIDLength"`
+	SessionNameInHTTPHeader string          `json:"SessionNameInHTTPHeader"`
+	SessionIDPrefix         string          `json:"sessionIDPrefix"`
+	CookieSameSite          http.SameSite   `json:"cookieSameSite"`
+	ErrorHook               ErrorHook       `json:"-"`
+	SerializerName          string          `json:"serializer"`
+	Serializer              Serializer      `json:"-"`
+	Compression             string          `json:"compression"`
+	MaxDecompressedSize     int64           `json:"maxDecompressedSize"`
+	EncryptionKeys          []EncryptionKey `json:"encryptionKeys"`
+	AllowPlaintextSessions  bool            `json:"allowPlaintextSessions"`
+	EnableSessionLock       bool            `json:"enableSessionLock"`
+	SessionLockTimeout      int64           `json:"sessionLockTimeout"`
+	SessionLockTTL          int64           `json:"sessionLockTTL"`
+	EnableVersionCheck      bool            `json:"enableVersionCheck"`
+	IdleTimeout             int64           `json:"idleTimeout"`
+	AbsoluteTimeout         int64           `json:"absoluteTimeout"`
+	AccessGranularity       int64           `json:"accessGranularity"`
+	EnableSessionMetadata   bool            `json:"enableSessionMetadata"`
+	MaxUserSessions         int             `json:"maxUserSessions"`
+	UserSessionPolicy       string          `json:"userSessionPolicy"`
 }
 
+// ErrorHook is called with errors the manager cannot return to the caller,
+// e.g. when a session could not be saved on release or destroyed.
+type ErrorHook func(ctx context.Context, sid string, err error)
+
 func (c *ManagerConfig) Opts(opts ...ManagerConfigOpt) {
 	for _, opt := range opts {
 		opt(c)
@@ -141,3 +165,111 @@ func CfgSameSite(sameSite http.SameSite) ManagerConfigOpt {
 		config.CookieSameSite = sameSite
 	}
 }
+
+// CfgErrorHook set the hook errors of releasing and destroying sessions are reported to
+func CfgErrorHook(hook ErrorHook) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.ErrorHook = hook
+	}
+}
+
+// CfgSerializerName set the name of a registered serializer, e.g. gob, json, msgpack or cbor
+func CfgSerializerName(name string) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.SerializerName = name
+	}
+}
+
+// CfgSerializer set the serializer of session values, it takes precedence over the serializer name
+func CfgSerializer(serializer Serializer) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.Serializer = serializer
+	}
+}
+
+// CfgCompression set the name of a registered compressor, e.g. gzip, zstd or snappy
+func CfgCompression(name string) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.Compression = name
+	}
+}
+
+// CfgMaxDecompressedSize set the size in bytes up to which compressed
+// sessions are decompressed, DefaultMaxDecompressedSize by default
+func CfgMaxDecompressedSize(size int64) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.MaxDecompressedSize = size
+	}
+}
+
+// CfgEncryptionKeys set the keyring, newest first, which encrypts the stored sessions
+// without binding them to their session IDs, see EncryptSerializer
+func CfgEncryptionKeys(keys ...EncryptionKey) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.EncryptionKeys = keys
+	}
+}
+
+// CfgAllowPlaintextSessions read sessions stored unencrypted, e.g. while
+// sessions written before encryption was turned on are migrated
+func CfgAllowPlaintextSessions(allow bool) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.AllowPlaintextSessions = allow
+	}
+}
+
+// CfgSessionLock lock sessions from SessionStart until they are released.
+// timeout is the number of seconds to wait for the lock, ttl the number of
+// seconds the lock of a crashed process is held, where the provider supports it.
+func CfgSessionLock(timeout, ttl int64) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.EnableSessionLock = true
+		config.SessionLockTimeout = timeout
+		config.SessionLockTTL = ttl
+	}
+}
+
+// CfgVersionCheck make SessionRelease return ErrSessionConflict for sessions
+// changed by another request since they were read
+func CfgVersionCheck(enable bool) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.EnableVersionCheck = enable
+	}
+}
+
+// CfgExpiration expire sessions idle for idle seconds or created absolute
+// seconds ago, whichever comes first. 0 disables a timeout.
+func CfgExpiration(idle, absolute int64) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.IdleTimeout = idle
+		config.AbsoluteTimeout = absolute
+	}
+}
+
+// CfgAccessGranularity record the access to a session at most once in
+// granularity seconds, so that requests in between don't modify the session.
+// The idle timeout may then be exceeded by up to granularity seconds. 0 is
+// 60 seconds or a tenth of the idle timeout, whichever is less, and a
+// negative granularity records every request.
+func CfgAccessGranularity(granularity int64) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.AccessGranularity = granularity
+	}
+}
+
+// CfgSessionMetadata record the metadata of sessions, see GetMetadata
+func CfgSessionMetadata(enable bool) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.EnableSessionMetadata = enable
+	}
+}
+
+// CfgUserSessionLimit limit the concurrent sessions of a user to max, with
+// RejectNewSession or EvictOldestSession. It applies only when a user is
+// assigned, see SetSessionUser
+func CfgUserSessionLimit(max int, policy string) ManagerConfigOpt {
+	return func(config *ManagerConfig) {
+		config.MaxUserSessions = max
+		config.UserSessionPolicy = policy
+	}
+}
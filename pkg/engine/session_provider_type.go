@@ -35,4 +35,5 @@ const (
 	ProviderRedisCluster  ProviderType = `redis_cluster`
 	ProviderRedisSentinel ProviderType = `redis_sentinel`
 	ProviderSsdb          ProviderType = `ssdb`
+	ProviderRemote        ProviderType = `remote`
 )
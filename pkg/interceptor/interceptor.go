@@ -0,0 +1,236 @@
+package interceptor
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// gRPC server interceptors which manage the sessions of a session manager
+//
+// Usage:
+// import(
+//   session "github.com/bhojpur/session/pkg/engine"
+//   "github.com/bhojpur/session/pkg/interceptor"
+// )
+//
+//	srv := grpc.NewServer(
+//		grpc.UnaryInterceptor(interceptor.UnaryServerInterceptor(globalSessions, "")),
+//		grpc.StreamInterceptor(interceptor.StreamServerInterceptor(globalSessions, "")),
+//	)
+//
+// Clients send the session ID in the metadata key, and receive the ID of new
+// or regenerated sessions in the response header of the same key.
+// The cookie provider cannot be used, it needs HTTP requests.
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+// DefaultMetadataKey is the metadata key of the session ID if no other is given
+const DefaultMetadataKey = "session-id"
+
+type sessionContextKey struct{}
+
+// rpcSession is the session of a call
+type rpcSession struct {
+	manager *session.Manager
+	key     string
+
+	mu        sync.Mutex
+	store     session.Store // nil once the session was destroyed
+	headerSet bool
+}
+
+// UnaryServerInterceptor returns an interceptor which starts the session
+// named by the metadata key of each call, stores it in the context of the
+// handler and releases it once the handler returns. Calls whose session
+// cannot be saved fail. The ID of the session is set in the response header
+// of key, which is DefaultMetadataKey if empty.
+func UnaryServerInterceptor(manager *session.Manager, key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		s, ctx, err := start(ctx, manager, key)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx, req)
+		if rerr := s.release(ctx); err == nil {
+			err = rerr
+		}
+		s.setHeader(func(md metadata.MD) error { return grpc.SetHeader(ctx, md) })
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor like UnaryServerInterceptor
+// for streams. The ID of the session is set in the response header before
+// the first message is sent, so the session must be regenerated before.
+func StreamServerInterceptor(manager *session.Manager, key string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		s, ctx, err := start(ss.Context(), manager, key)
+		if err != nil {
+			return err
+		}
+		err = handler(srv, &serverStream{ServerStream: ss, ctx: ctx, session: s})
+		if rerr := s.release(ctx); err == nil {
+			err = rerr
+		}
+		s.setHeader(ss.SetHeader)
+		return err
+	}
+}
+
+// FromContext returns the session of a call served by the interceptors, or
+// nil for other contexts.
+func FromContext(ctx context.Context) session.Store {
+	s := sessionFromContext(ctx)
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.store
+}
+
+// RegenerateID moves the session of the call to a new ID, which is sent to
+// the client instead of the old one.
+func RegenerateID(ctx context.Context) (session.Store, error) {
+	s := sessionFromContext(ctx)
+	if s == nil {
+		return nil, status.Error(codes.Internal, "session: no session in the context")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldsid := ""
+	if s.store != nil {
+		oldsid = s.store.SessionID(ctx)
+	}
+	store, err := s.manager.SessionRegenerateWithID(ctx, oldsid)
+	if err != nil {
+		return nil, err
+	}
+	s.store = store
+	return store, nil
+}
+
+// Destroy destroys the session of the call. No session ID is sent to the
+// client.
+func Destroy(ctx context.Context) error {
+	s := sessionFromContext(ctx)
+	if s == nil {
+		return status.Error(codes.Internal, "session: no session in the context")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		return nil
+	}
+	sid := s.store.SessionID(ctx)
+	s.store = nil
+	return s.manager.SessionDestroyWithID(ctx, sid)
+}
+
+func start(ctx context.Context, manager *session.Manager, key string) (*rpcSession, context.Context, error) {
+	if key == "" {
+		key = DefaultMetadataKey
+	}
+	var sid string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if sids := md.Get(key); len(sids) > 0 {
+			sid = sids[0]
+		}
+	}
+	store, err := manager.SessionStartWithID(ctx, sid)
+	if err != nil {
+		return nil, ctx, toStatus(err)
+	}
+	s := &rpcSession{manager: manager, key: key, store: store}
+	return s, context.WithValue(ctx, sessionContextKey{}, s), nil
+}
+
+func sessionFromContext(ctx context.Context) *rpcSession {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(sessionContextKey{}).(*rpcSession)
+	return s
+}
+
+// release saves the session, if it was not destroyed
+func (s *rpcSession) release(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.store == nil {
+		return nil
+	}
+	return toStatus(s.manager.SessionRelease(ctx, session.NopResponseWriter{}, s.store))
+}
+
+// setHeader sets the session ID in the response header the first time it's
+// called. Errors are ignored, the header is sent already then.
+func (s *rpcSession) setHeader(set func(metadata.MD) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.headerSet || s.store == nil {
+		return
+	}
+	s.headerSet = true
+	set(metadata.Pairs(s.key, s.store.SessionID(context.Background())))
+}
+
+// toStatus converts session errors to gRPC errors
+func toStatus(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case session.ErrSessionLockTimeout, session.ErrSessionConflict:
+		return status.Error(codes.Aborted, err.Error())
+	case context.Canceled, context.DeadlineExceeded:
+		return status.FromContextError(err).Err()
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// serverStream carries the context with the session and sets the header
+// with the session ID before the first message is sent
+type serverStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	session *rpcSession
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) SendHeader(md metadata.MD) error {
+	ss.session.setHeader(ss.ServerStream.SetHeader)
+	return ss.ServerStream.SendHeader(md)
+}
+
+func (ss *serverStream) SendMsg(m interface{}) error {
+	ss.session.setHeader(ss.ServerStream.SetHeader)
+	return ss.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,154 @@
+package interceptor
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+// transportStream records the header set by the interceptors
+type transportStream struct {
+	header metadata.MD
+}
+
+func (ts *transportStream) Method() string { return "/test/Call" }
+
+func (ts *transportStream) SetHeader(md metadata.MD) error {
+	ts.header = metadata.Join(ts.header, md)
+	return nil
+}
+
+func (ts *transportStream) SendHeader(md metadata.MD) error { return ts.SetHeader(md) }
+
+func (ts *transportStream) SetTrailer(metadata.MD) error { return nil }
+
+// serverStreamStub is a grpc.ServerStream without messages
+type serverStreamStub struct {
+	grpc.ServerStream
+	ctx context.Context
+	ts  *transportStream
+}
+
+func (ss *serverStreamStub) Context() context.Context       { return ss.ctx }
+func (ss *serverStreamStub) SetHeader(md metadata.MD) error { return ss.ts.SetHeader(md) }
+func (ss *serverStreamStub) SendMsg(interface{}) error      { return nil }
+
+func newManager(t *testing.T) *session.Manager {
+	manager, err := session.NewManager("memory", session.NewManagerConfig(
+		session.CfgCookieName("bsessionid"),
+		session.CfgGcLifeTime(3600),
+	))
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+	return manager
+}
+
+// call runs the unary interceptor with the session ID sid and returns the
+// session ID of the response header
+func call(t *testing.T, manager *session.Manager, sid string, handler grpc.UnaryHandler) (string, error) {
+	ts := &transportStream{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), ts)
+	if sid != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(DefaultMetadataKey, sid))
+	}
+	_, err := UnaryServerInterceptor(manager, "")(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	if sids := ts.header.Get(DefaultMetadataKey); len(sids) == 1 {
+		return sids[0], err
+	} else if len(sids) > 1 {
+		t.Fatal("session ID set more than once:", sids)
+	}
+	return "", err
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	manager := newManager(t)
+	ctx := context.Background()
+
+	sid, err := call(t, manager, "", func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, FromContext(ctx).Set(ctx, "username", "bhojpur")
+	})
+	if err != nil || sid == "" {
+		t.Fatal("no session ID in the header:", err)
+	}
+
+	regenerated, err := call(t, manager, sid, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if username, _ := FromContext(ctx).Get(ctx, "username"); username != "bhojpur" {
+			t.Fatal("session was not read, got", username)
+		}
+		_, err := RegenerateID(ctx)
+		return nil, err
+	})
+	if err != nil || regenerated == "" || regenerated == sid {
+		t.Fatalf("regenerated session ID %q, err %v", regenerated, err)
+	}
+	if exists, _ := manager.GetProvider().SessionExist(ctx, sid); exists {
+		t.Fatal("old session still exists")
+	}
+
+	sid, err = call(t, manager, regenerated, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, Destroy(ctx)
+	})
+	if err != nil || sid != "" {
+		t.Fatalf("got session ID %q of destroyed session, err %v", sid, err)
+	}
+	if exists, _ := manager.GetProvider().SessionExist(ctx, regenerated); exists {
+		t.Fatal("destroyed session still exists")
+	}
+
+	if FromContext(ctx) != nil {
+		t.Fatal("expected no session outside the interceptors")
+	}
+	if _, err = RegenerateID(ctx); status.Code(err) != codes.Internal {
+		t.Fatal("expected error without session, got", err)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	manager := newManager(t)
+	ts := &transportStream{}
+	ss := &serverStreamStub{ctx: context.Background(), ts: ts}
+
+	var sid string
+	err := StreamServerInterceptor(manager, "custom-key")(nil, ss, &grpc.StreamServerInfo{}, func(srv interface{}, stream grpc.ServerStream) error {
+		ctx := stream.Context()
+		store, err := RegenerateID(ctx)
+		if err != nil {
+			return err
+		}
+		sid = store.SessionID(ctx)
+		return stream.SendMsg(nil)
+	})
+	if err != nil {
+		t.Fatal("stream failed:", err)
+	}
+	if sids := ts.header.Get("custom-key"); len(sids) != 1 || sids[0] != sid {
+		t.Fatalf("expected session ID %q in the header, got %v", sid, sids)
+	}
+}
@@ -41,6 +41,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	couchbase "github.com/couchbase/go-couchbase"
 
@@ -51,20 +52,29 @@ var couchbpder = &Provider{}
 
 // SessionStore store each session
 type SessionStore struct {
+	bmu         sync.Mutex // serializes the use of b
 	b           *couchbase.Bucket
 	sid         string
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
+	dirty       bool
 	maxlifetime int64
+	serializer  session.Serializer
+
+	// version checks, see session.ErrSessionConflict
+	check bool
+	cas   uint64 // CAS of the session as read or last written, 0 for new sessions
 }
 
 // Provider couchabse provided
 type Provider struct {
+	session.ProviderSerializer
+	session.ProviderVersionCheck
+
 	maxlifetime int64
 	SavePath    string `json:"save_path"`
 	Pool        string `json:"pool"`
 	Bucket      string `json:"bucket"`
-	b           *couchbase.Bucket
 }
 
 // Set value to couchabse session
@@ -72,17 +82,29 @@ func (cs *SessionStore) Set(ctx context.Context, key, value interface{}) error {
 	cs.lock.Lock()
 	defer cs.lock.Unlock()
 	cs.values[key] = value
+	cs.dirty = true
 	return nil
 }
 
 // Get value from couchabse session
-func (cs *SessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (cs *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	cs.lock.RLock()
 	defer cs.lock.RUnlock()
 	if v, ok := cs.values[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in couchbase session
+func (cs *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	cs.lock.RLock()
+	defer cs.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(cs.values))
+	for k, v := range cs.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete value in couchbase session by given key
@@ -90,6 +112,7 @@ func (cs *SessionStore) Delete(ctx context.Context, key interface{}) error {
 	cs.lock.Lock()
 	defer cs.lock.Unlock()
 	delete(cs.values, key)
+	cs.dirty = true
 	return nil
 }
 
@@ -98,6 +121,7 @@ func (cs *SessionStore) Flush(context.Context) error {
 	cs.lock.Lock()
 	defer cs.lock.Unlock()
 	cs.values = make(map[interface{}]interface{})
+	cs.dirty = true
 	return nil
 }
 
@@ -107,34 +131,110 @@ func (cs *SessionStore) SessionID(context.Context) string {
 }
 
 // SessionRelease Write couchbase session with Gob string
-func (cs *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
-	defer cs.b.Close()
+func (cs *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	defer cs.close()
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	if !cs.dirty {
+		// only refresh the expiry of sessions which were not modified
+		return cs.do(ctx, func(b *couchbase.Bucket) error {
+			_, _, err := b.GetAndTouchRaw(cs.sid, cs.expiration())
+			return err
+		})
+	}
 
-	bo, err := session.EncodeGob(cs.values)
+	bo, err := cs.serializer.Serialize(cs.values)
 	if err != nil {
-		return
+		return err
+	}
+	if cs.check {
+		return cs.releaseVersion(ctx, bo)
 	}
 
-	cs.b.Set(cs.sid, int(cs.maxlifetime), bo)
+	err = cs.do(ctx, func(b *couchbase.Bucket) error {
+		return b.Set(cs.sid, cs.expiration(), bo)
+	})
+	if err == nil {
+		cs.dirty = false
+	}
+	return err
 }
 
-func (cp *Provider) getBucket() *couchbase.Bucket {
-	c, err := couchbase.Connect(cp.SavePath)
-	if err != nil {
-		return nil
+// do runs fn with the bucket of the session unless ctx is done first. Calls
+// are serialized, also with calls which are still running after their
+// context was done.
+func (cs *SessionStore) do(ctx context.Context, fn func(b *couchbase.Bucket) error) error {
+	return session.RunWithContext(ctx, func() error {
+		cs.bmu.Lock()
+		defer cs.bmu.Unlock()
+		return fn(cs.b)
+	})
+}
+
+// close closes the bucket of the session once no call uses it anymore,
+// without waiting for calls which are still running after their context
+// was done
+func (cs *SessionStore) close() {
+	go func() {
+		cs.bmu.Lock()
+		defer cs.bmu.Unlock()
+		cs.b.Close()
+	}()
+}
+
+// expiration returns the couchbase expiry of the session, see
+// session.SetLifetime. Expiries beyond 30 days must be Unix times.
+func (cs *SessionStore) expiration() int {
+	lifetime := session.ValuesLifetime(cs.values, cs.maxlifetime)
+	if lifetime > 30*24*60*60 {
+		lifetime += time.Now().Unix()
 	}
+	return int(lifetime)
+}
 
-	pool, err := c.GetPool(cp.Pool)
+// releaseVersion writes the session with its CAS, so that it's only written
+// if no other request wrote it since it was read
+func (cs *SessionStore) releaseVersion(ctx context.Context, bo []byte) error {
+	err := cs.do(ctx, func(b *couchbase.Bucket) (err error) {
+		var cas uint64
+		if cs.cas == 0 {
+			var added bool
+			added, cas, err = b.AddWithCAS(cs.sid, cs.expiration(), bo)
+			if err == nil && !added {
+				err = couchbase.ErrKeyExists
+			}
+		} else {
+			cas, err = b.Cas(cs.sid, cs.expiration(), cs.cas, bo)
+		}
+		if err == nil {
+			cs.cas = cas
+		}
+		return err
+	})
+	if err == couchbase.ErrKeyExists || couchbase.IsKeyEExistsError(err) || couchbase.IsKeyNoEntError(err) {
+		return session.ErrSessionConflict
+	}
+	if err == nil {
+		cs.dirty = false
+	}
+	return err
+}
+
+// getBucket connects to the bucket. Every call uses its own bucket, so that
+// calls which are still running after their context was done don't share it.
+func (cp *Provider) getBucket() (*couchbase.Bucket, error) {
+	c, err := couchbase.Connect(cp.SavePath)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	bucket, err := pool.GetBucket(cp.Bucket)
+	pool, err := c.GetPool(cp.Pool)
 	if err != nil {
-		return nil
+		return nil, err
 	}
 
-	return bucket
+	return pool.GetBucket(cp.Bucket)
 }
 
 // SessionInit init couchbase session
@@ -171,39 +271,60 @@ func (cp *Provider) initOldStyle(savePath string) error {
 
 // SessionRead read couchbase session by sid
 func (cp *Provider) SessionRead(ctx context.Context, sid string) (session.Store, error) {
-	cp.b = cp.getBucket()
-
 	var (
 		kv  map[interface{}]interface{}
 		err error
 		doc []byte
+		cas uint64
+		b   *couchbase.Bucket
 	)
 
-	err = cp.b.Get(sid, &doc)
+	err = session.RunWithContext(ctx, func() error {
+		bucket, err := cp.getBucket()
+		if err != nil {
+			return err
+		}
+		if err := bucket.Gets(sid, &doc, &cas); err != nil {
+			bucket.Close()
+			return err
+		}
+		b = bucket
+		return nil
+	})
 	if err != nil {
 		return nil, err
-	} else if doc == nil {
+	}
+	// new sessions are written on release even without values
+	dirty := doc == nil
+	if dirty {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob(doc)
+		kv, err = cp.Serializer().Deserialize(doc)
 		if err != nil {
+			b.Close()
 			return nil, err
 		}
 	}
 
-	cs := &SessionStore{b: cp.b, sid: sid, values: kv, maxlifetime: cp.maxlifetime}
+	cs := &SessionStore{b: b, sid: sid, values: kv, dirty: dirty, maxlifetime: cp.maxlifetime, serializer: cp.Serializer(),
+		check: cp.VersionCheck(), cas: cas}
 	return cs, nil
 }
 
 // SessionExist Check couchbase session exist.
 // it checkes sid exist or not.
 func (cp *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
-	cp.b = cp.getBucket()
-	defer cp.b.Close()
-
 	var doc []byte
 
-	if err := cp.b.Get(sid, &doc); err != nil || doc == nil {
+	err := session.RunWithContext(ctx, func() error {
+		b, err := cp.getBucket()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
+		return b.Get(sid, &doc)
+	})
+	if err != nil || doc == nil {
 		return false, err
 	}
 	return true, nil
@@ -211,20 +332,31 @@ func (cp *Provider) SessionExist(ctx context.Context, sid string) (bool, error)
 
 // SessionRegenerate remove oldsid and use sid to generate new session
 func (cp *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (session.Store, error) {
-	cp.b = cp.getBucket()
-
-	var doc []byte
-	if err := cp.b.Get(oldsid, &doc); err != nil || doc == nil {
-		cp.b.Set(sid, int(cp.maxlifetime), "")
-	} else {
-		err := cp.b.Delete(oldsid)
+	var (
+		doc []byte
+		cas uint64
+		b   *couchbase.Bucket
+	)
+	err := session.RunWithContext(ctx, func() error {
+		bucket, err := cp.getBucket()
 		if err != nil {
-			return nil, err
+			return err
 		}
-		_, _ = cp.b.Add(sid, int(cp.maxlifetime), doc)
-	}
-
-	err := cp.b.Get(sid, &doc)
+		if err = bucket.Get(oldsid, &doc); err != nil || doc == nil {
+			err = bucket.Set(sid, int(cp.maxlifetime), "")
+		} else if err = bucket.Delete(oldsid); err == nil {
+			_, err = bucket.Add(sid, int(cp.maxlifetime), doc)
+		}
+		if err == nil {
+			err = bucket.Gets(sid, &doc, &cas)
+		}
+		if err != nil {
+			bucket.Close()
+			return err
+		}
+		b = bucket
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -232,23 +364,32 @@ func (cp *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (
 	if doc == nil {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob(doc)
+		kv, err = cp.Serializer().Deserialize(doc)
 		if err != nil {
+			b.Close()
 			return nil, err
 		}
 	}
 
-	cs := &SessionStore{b: cp.b, sid: sid, values: kv, maxlifetime: cp.maxlifetime}
+	cs := &SessionStore{b: b, sid: sid, values: kv, dirty: doc == nil, maxlifetime: cp.maxlifetime, serializer: cp.Serializer(),
+		check: cp.VersionCheck(), cas: cas}
 	return cs, nil
 }
 
 // SessionDestroy Remove Bucket in this couchbase
 func (cp *Provider) SessionDestroy(ctx context.Context, sid string) error {
-	cp.b = cp.getBucket()
-	defer cp.b.Close()
+	return session.RunWithContext(ctx, func() error {
+		b, err := cp.getBucket()
+		if err != nil {
+			return err
+		}
+		defer b.Close()
 
-	cp.b.Delete(sid)
-	return nil
+		if err := b.Delete(sid); err != nil && !couchbase.IsKeyNoEntError(err) {
+			return err
+		}
+		return nil
+	})
 }
 
 // SessionGC Recycle
@@ -0,0 +1,287 @@
+package grpc
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// depend on the SessionStore gRPC API served by sessionsvr
+//
+// Usage:
+// import(
+//   _ "github.com/bhojpur/session/pkg/provider/grpc"
+//   session "github.com/bhojpur/session/pkg/engine"
+// )
+//
+//	func init() {
+//		globalSessions, _ = session.NewManager("remote", ``{"cookieName":"bsessionid","gclifetime":3600,"ProviderConfig":"{\"addr\":\"localhost:7777\",\"engine\":\"\",\"timeout\":\"5s\"}"}``)
+//		go globalSessions.GC()
+//	}
+//
+// The session IDs are generated by the manager of the application, so
+// sessionsvr must be started with --accept-session-ids.
+//
+// Session keys are stored as strings and values pass through their JSON
+// representation, e.g. numbers are read back as float64.
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+var remotepder = &Provider{}
+
+// SessionStore remote session store
+type SessionStore struct {
+	p      *Provider
+	sid    string
+	lock   sync.RWMutex
+	values map[interface{}]interface{}
+}
+
+// Set value in remote session
+func (rs *SessionStore) Set(ctx context.Context, key, value interface{}) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.values[key] = value
+	return nil
+}
+
+// Get value in remote session
+func (rs *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	if v, ok := rs.values[key]; ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+// Values return a copy of all values in remote session
+func (rs *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(rs.values))
+	for k, v := range rs.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Delete value in remote session
+func (rs *SessionStore) Delete(ctx context.Context, key interface{}) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	delete(rs.values, key)
+	return nil
+}
+
+// Flush clear all values in remote session
+func (rs *SessionStore) Flush(context.Context) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.values = make(map[interface{}]interface{})
+	return nil
+}
+
+// SessionID get remote session id
+func (rs *SessionStore) SessionID(context.Context) string {
+	return rs.sid
+}
+
+// SessionRelease save session values to the session server
+func (rs *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	rs.lock.RLock()
+	values, err := v1.NewValues(rs.values)
+	rs.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := rs.p.callContext(ctx)
+	defer cancel()
+	_, err = rs.p.client.SetValues(ctx, &v1.SetValuesRequest{
+		Engine:    rs.p.Engine,
+		SessionId: rs.sid,
+		Values:    values,
+		Replace:   true,
+	})
+	return err
+}
+
+// Provider remote session provider
+type Provider struct {
+	maxlifetime int64
+	Addr        string `json:"addr"`
+	Engine      string `json:"engine"`
+
+	timeout    time.Duration
+	TimeoutStr string `json:"timeout"`
+
+	conn   *grpclib.ClientConn
+	client v1.SessionStoreClient
+}
+
+// SessionInit init remote session
+// cfgStr like session server addr,engine
+// v1.x e.g. localhost:7777,default.1
+// v2.0 you should pass json string
+// e.g. { "addr": "localhost:7777", "engine": "default.1", "timeout": "5s" }
+func (rp *Provider) SessionInit(ctx context.Context, maxlifetime int64, cfgStr string) error {
+	rp.maxlifetime = maxlifetime
+
+	cfgStr = strings.TrimSpace(cfgStr)
+	// we think cfgStr is v2.0, using json to init the session
+	if strings.HasPrefix(cfgStr, "{") {
+		err := json.Unmarshal([]byte(cfgStr), rp)
+		if err != nil {
+			return err
+		}
+		if rp.TimeoutStr != "" {
+			rp.timeout, err = time.ParseDuration(rp.TimeoutStr)
+			if err != nil {
+				return err
+			}
+		}
+	} else {
+		rp.initOldStyle(cfgStr)
+	}
+
+	if rp.conn != nil {
+		rp.conn.Close()
+	}
+	conn, err := grpclib.Dial(rp.Addr, grpclib.WithInsecure())
+	if err != nil {
+		return err
+	}
+	rp.conn = conn
+	rp.client = v1.NewSessionStoreClient(conn)
+	return nil
+}
+
+func (rp *Provider) initOldStyle(cfgStr string) {
+	configs := strings.Split(cfgStr, ",")
+	if len(configs) > 0 {
+		rp.Addr = configs[0]
+	}
+	if len(configs) > 1 {
+		rp.Engine = configs[1]
+	}
+}
+
+// callContext returns the context for a call to the session server,
+// bounded by the configured timeout
+func (rp *Provider) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if rp.timeout > 0 {
+		return context.WithTimeout(ctx, rp.timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// SessionRead read remote session by sid, the session is created if it does not exist
+func (rp *Provider) SessionRead(ctx context.Context, sid string) (session.Store, error) {
+	ctx, cancel := rp.callContext(ctx)
+	defer cancel()
+
+	resp, err := rp.client.GetSession(ctx, &v1.GetSessionRequest{Engine: rp.Engine, SessionId: sid})
+	if status.Code(err) == codes.NotFound {
+		_, err = rp.client.CreateSession(ctx, &v1.CreateSessionRequest{Engine: rp.Engine, SessionId: sid})
+		if err != nil && status.Code(err) != codes.AlreadyExists {
+			return nil, err
+		}
+		resp, err = rp.client.GetSession(ctx, &v1.GetSessionRequest{Engine: rp.Engine, SessionId: sid})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rs := &SessionStore{p: rp, sid: sid, values: v1.AsSessionValues(resp.Values)}
+	return rs, nil
+}
+
+// SessionExist check remote session exist by sid
+func (rp *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
+	ctx, cancel := rp.callContext(ctx)
+	defer cancel()
+
+	resp, err := rp.client.SessionExists(ctx, &v1.SessionExistsRequest{Engine: rp.Engine, SessionId: sid})
+	if err != nil {
+		return false, err
+	}
+	return resp.Exists, nil
+}
+
+// SessionRegenerate generate new sid for remote session
+func (rp *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (session.Store, error) {
+	callCtx, cancel := rp.callContext(ctx)
+	_, err := rp.client.RegenerateSession(callCtx, &v1.RegenerateSessionRequest{
+		Engine:       rp.Engine,
+		SessionId:    oldsid,
+		NewSessionId: sid,
+	})
+	cancel()
+	// oldsid doesn't exists, SessionRead creates the new sid directly
+	if err != nil && status.Code(err) != codes.NotFound {
+		return nil, err
+	}
+	return rp.SessionRead(ctx, sid)
+}
+
+// SessionDestroy delete remote session by id
+func (rp *Provider) SessionDestroy(ctx context.Context, sid string) error {
+	ctx, cancel := rp.callContext(ctx)
+	defer cancel()
+
+	_, err := rp.client.DestroySession(ctx, &v1.DestroySessionRequest{Engine: rp.Engine, SessionId: sid})
+	return err
+}
+
+// SessionGC Impelment method, no used.
+// Sessions are garbage collected by the session server.
+func (rp *Provider) SessionGC(context.Context) {
+}
+
+// SessionAll return all activeSession
+func (rp *Provider) SessionAll(ctx context.Context) int {
+	ctx, cancel := rp.callContext(ctx)
+	defer cancel()
+
+	resp, err := rp.client.CountSessions(ctx, &v1.CountSessionsRequest{Engine: rp.Engine})
+	if err != nil {
+		return 0
+	}
+	return int(resp.Count)
+}
+
+func init() {
+	session.Register("remote", remotepder)
+}
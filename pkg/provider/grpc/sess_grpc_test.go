@@ -0,0 +1,138 @@
+package grpc
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	grpclib "google.golang.org/grpc"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	session "github.com/bhojpur/session/pkg/engine"
+	"github.com/bhojpur/session/pkg/server"
+)
+
+func startServer(t *testing.T) (addr string, stop func()) {
+	engines := server.NewRegistry()
+	started, err := engines.Start(nil, []byte("provider: memory\nconfig:\n  gclifetime: 3600\n"), "", time.Time{})
+	if err != nil {
+		t.Fatal("cannot start engine:", err)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err = engines.Manager(started.Name); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("cannot listen:", err)
+	}
+	srv := grpclib.NewServer()
+	store := server.NewStoreService(engines, started.Name)
+	store.AcceptSessionIDs = true
+	v1.RegisterSessionStoreServer(srv, store)
+	go srv.Serve(lis)
+
+	return lis.Addr().String(), func() {
+		srv.Stop()
+		engines.Close()
+	}
+}
+
+func TestRemote(t *testing.T) {
+	addr, stop := startServer(t)
+	defer stop()
+
+	globalSession, err := session.NewManager("remote", &session.ManagerConfig{
+		CookieName:      "bsessionid",
+		EnableSetCookie: true,
+		Gclifetime:      3600,
+		ProviderConfig:  fmt.Sprintf(`{"addr":"%s","timeout":"5s"}`, addr),
+	})
+	if err != nil {
+		t.Fatal("could not create manager:", err)
+	}
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	sess, err := globalSession.SessionStart(w, r)
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	err = sess.Set(context.Background(), "username", "bhojpur")
+	if err != nil {
+		t.Fatal("set username failed:", err)
+	}
+	err = sess.SessionRelease(context.Background(), w)
+	if err != nil {
+		t.Fatal("release failed:", err)
+	}
+
+	// a second request with the session cookie sees the stored value
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", w.Header().Get("Set-Cookie"))
+	sess2, err := globalSession.SessionStart(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	assert.Equal(t, sess.SessionID(context.Background()), sess2.SessionID(context.Background()))
+	username, err := sess2.Get(context.Background(), "username")
+	assert.NoError(t, err)
+	assert.Equal(t, "bhojpur", username)
+	assert.True(t, globalSession.GetActiveSession() > 0)
+
+	regenerated, err := globalSession.SessionRegenerateID(httptest.NewRecorder(), r)
+	if err != nil {
+		t.Fatal("session regenerate failed:", err)
+	}
+	username, err = regenerated.Get(context.Background(), "username")
+	assert.NoError(t, err)
+	assert.Equal(t, "bhojpur", username)
+
+	err = globalSession.GetProvider().SessionDestroy(context.Background(), regenerated.SessionID(context.Background()))
+	assert.Nil(t, err)
+	exists, err := globalSession.GetProvider().SessionExist(context.Background(), regenerated.SessionID(context.Background()))
+	assert.Nil(t, err)
+	assert.False(t, exists)
+}
+
+func TestProvider_SessionInit(t *testing.T) {
+	cp := &Provider{}
+	cp.SessionInit(context.Background(), 12, `{ "addr": "localhost:7777", "engine": "default.1", "timeout": "3s"}`)
+	assert.Equal(t, "localhost:7777", cp.Addr)
+	assert.Equal(t, "default.1", cp.Engine)
+	assert.Equal(t, 3*time.Second, cp.timeout)
+	assert.Equal(t, int64(12), cp.maxlifetime)
+
+	cp = &Provider{}
+	cp.SessionInit(context.Background(), 12, `localhost:7777,default.1`)
+	assert.Equal(t, "localhost:7777", cp.Addr)
+	assert.Equal(t, "default.1", cp.Engine)
+}
@@ -0,0 +1,509 @@
+// Package redisstore implements the sessions of the redis, redis_cluster and
+// redis_sentinel providers, which only differ in their client.
+package redisstore
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+const (
+	// LayoutString stores a session as one serialized string, the default
+	LayoutString = "string"
+	// LayoutHash stores every key of a session as a field of a hash and
+	// only writes the keys a request changed. Concurrent requests for the
+	// same session then only overwrite each other's changes of the same key.
+	LayoutHash = "hash"
+)
+
+// lockSuffix is appended to the session ID for the key of its lock
+const lockSuffix = ".lock"
+
+// userIndexPrefix is prepended to a user ID for the key of the sorted set of
+// sessions of the user, scored by their creation time
+const userIndexPrefix = "bhojpur.session.user:"
+
+// hashPlaceholder is a field of every session hash, so that sessions
+// without values exist
+const hashPlaceholder = ""
+
+// SessionStore redis session store
+type SessionStore struct {
+	p           redis.UniversalClient
+	sid         string
+	lock        sync.RWMutex
+	values      map[interface{}]interface{}
+	dirty       bool
+	maxlifetime int64
+	serializer  session.Serializer
+
+	// hash layout, see LayoutHash
+	hash    bool
+	changed map[interface{}]struct{} // keys changed since the session was read
+	flushed bool                     // all keys are written again
+
+	// version checks, see session.ErrSessionConflict
+	check   bool
+	version uint64 // version of the session when it was read
+}
+
+// Set value in redis session
+func (rs *SessionStore) Set(ctx context.Context, key, value interface{}) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.values[key] = value
+	rs.changed[key] = struct{}{}
+	rs.dirty = true
+	return nil
+}
+
+// Get value in redis session
+func (rs *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	if v, ok := rs.values[key]; ok {
+		return v, nil
+	}
+	return nil, nil
+}
+
+// Values return a copy of all values in redis session
+func (rs *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(rs.values))
+	for k, v := range rs.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Delete value in redis session
+func (rs *SessionStore) Delete(ctx context.Context, key interface{}) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	delete(rs.values, key)
+	rs.changed[key] = struct{}{}
+	rs.dirty = true
+	return nil
+}
+
+// Flush clear all values in redis session
+func (rs *SessionStore) Flush(context.Context) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	rs.values = make(map[interface{}]interface{})
+	rs.changed = make(map[interface{}]struct{})
+	rs.flushed = true
+	rs.dirty = true
+	return nil
+}
+
+// SessionID get redis session id
+func (rs *SessionStore) SessionID(context.Context) string {
+	return rs.sid
+}
+
+// SessionRelease save session values to redis.
+// Sessions which were not modified only have their expiry refreshed.
+func (rs *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	c := withContext(rs.p, ctx)
+	if !rs.dirty {
+		if err := c.Expire(rs.sid, rs.lifetime()).Err(); err != nil {
+			return err
+		}
+		return rs.indexUser(c)
+	}
+	write, err := rs.writer()
+	if err != nil {
+		return err
+	}
+	if rs.check {
+		err = rs.releaseVersion(c, write)
+	} else {
+		_, err = c.TxPipelined(write)
+	}
+	if err != nil {
+		return err
+	}
+	if rs.check {
+		rs.version++
+	}
+	rs.dirty, rs.flushed = false, false
+	rs.changed = make(map[interface{}]struct{})
+	return rs.indexUser(c)
+}
+
+// indexUser keeps the set of sessions of its user for as long as the session
+// itself, see session.UserIndexer
+func (rs *SessionStore) indexUser(c redis.UniversalClient) error {
+	user, _ := rs.values[session.UserKey].(string)
+	if user == "" {
+		return nil
+	}
+	return indexScript.Run(c, []string{userIndexPrefix + user}, int64(rs.lifetime()/time.Second)).Err()
+}
+
+// lifetime returns the expiry of the session, see session.SetLifetime
+func (rs *SessionStore) lifetime() time.Duration {
+	return time.Duration(session.ValuesLifetime(rs.values, rs.maxlifetime)) * time.Second
+}
+
+// writer returns the commands writing the session with its layout. With
+// the hash layout only the keys changed since the session was read are
+// written, so concurrent requests only overwrite the same keys.
+func (rs *SessionStore) writer() (func(redis.Pipeliner) error, error) {
+	expiration := rs.lifetime()
+	if !rs.hash {
+		b, err := rs.serializer.Serialize(rs.values)
+		if err != nil {
+			return nil, err
+		}
+		if rs.check {
+			b = session.EncodeVersion(rs.version+1, b)
+		}
+		return func(pipe redis.Pipeliner) error {
+			pipe.Set(rs.sid, string(b), expiration)
+			return nil
+		}, nil
+	}
+
+	keys := rs.changed
+	if rs.flushed {
+		keys = make(map[interface{}]struct{}, len(rs.values))
+		for key := range rs.values {
+			keys[key] = struct{}{}
+		}
+	}
+	// the placeholder keeps sessions without values and holds the version
+	placeholder := ""
+	if rs.check {
+		placeholder = strconv.FormatUint(rs.version+1, 10)
+	}
+	fields := []interface{}{hashPlaceholder, placeholder}
+	var deleted []string
+	for key := range keys {
+		value, ok := rs.values[key]
+		if !ok {
+			deleted = append(deleted, hashField(key))
+			continue
+		}
+		b, err := rs.serializer.Serialize(map[interface{}]interface{}{key: value})
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, hashField(key), b)
+	}
+	return func(pipe redis.Pipeliner) error {
+		if rs.flushed {
+			pipe.Del(rs.sid)
+		} else if len(deleted) > 0 {
+			pipe.HDel(rs.sid, deleted...)
+		}
+		pipe.HSet(rs.sid, fields...)
+		pipe.Expire(rs.sid, expiration)
+		return nil
+	}, nil
+}
+
+// releaseVersion runs write only if the stored session still has the version
+// it was read with, otherwise it returns session.ErrSessionConflict
+func (rs *SessionStore) releaseVersion(c redis.UniversalClient, write func(redis.Pipeliner) error) error {
+	err := c.Watch(func(tx *redis.Tx) error {
+		version, err := storedVersion(tx, rs.sid)
+		if err != nil {
+			return err
+		}
+		if version != rs.version {
+			return session.ErrSessionConflict
+		}
+		_, err = tx.TxPipelined(write)
+		return err
+	}, rs.sid)
+	if err == redis.TxFailedErr {
+		return session.ErrSessionConflict
+	}
+	return err
+}
+
+// Provider implements the session provider of the redis providers with a
+// client of any of them. The providers embed it and set it up with Init.
+type Provider struct {
+	session.ProviderSerializer
+	session.ProviderVersionCheck
+
+	client      redis.UniversalClient
+	maxlifetime int64
+	layout      string
+}
+
+// ValidLayout reports whether layout is empty, LayoutString or LayoutHash
+func ValidLayout(layout string) bool {
+	switch layout {
+	case "", LayoutString, LayoutHash:
+		return true
+	}
+	return false
+}
+
+// Init sets up the provider with client and checks the connection
+func (rp *Provider) Init(ctx context.Context, client redis.UniversalClient, maxlifetime int64, layout string) error {
+	rp.client, rp.maxlifetime, rp.layout = client, maxlifetime, layout
+	return withContext(rp.client, ctx).Ping().Err()
+}
+
+// SessionRead read redis session by sid
+func (rp *Provider) SessionRead(ctx context.Context, sid string) (session.Store, error) {
+	c := withContext(rp.client, ctx)
+	rs := &SessionStore{p: rp.client, sid: sid, maxlifetime: rp.maxlifetime, serializer: rp.Serializer(),
+		hash: rp.layout == LayoutHash, changed: make(map[interface{}]struct{}), check: rp.VersionCheck()}
+
+	read, fallback := rp.readString, rp.readHash
+	if rs.hash {
+		read, fallback = rp.readHash, rp.readString
+	}
+	var (
+		exists bool
+		err    error
+	)
+	rs.values, rs.version, exists, err = read(c, sid)
+	if isWrongType(err) {
+		// the session was written with the other layout, it's rewritten on release
+		rs.values, rs.version, _, err = fallback(c, sid)
+		exists, rs.flushed = false, true
+	}
+	if err != nil {
+		return nil, err
+	}
+	// new sessions are written on release even without values
+	rs.dirty = !exists
+	return rs, nil
+}
+
+// readString reads a session stored with LayoutString
+func (rp *Provider) readString(c redis.UniversalClient, sid string) (map[interface{}]interface{}, uint64, bool, error) {
+	kvs, err := c.Get(sid).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, 0, false, err
+	}
+	version, kvs := session.DecodeVersion(kvs)
+	if len(kvs) == 0 {
+		return make(map[interface{}]interface{}), version, false, nil
+	}
+	kv, err := rp.Serializer().Deserialize(kvs)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return kv, version, true, nil
+}
+
+// readHash reads a session stored with LayoutHash
+func (rp *Provider) readHash(c redis.UniversalClient, sid string) (map[interface{}]interface{}, uint64, bool, error) {
+	fields, err := c.HGetAll(sid).Result()
+	if err != nil {
+		return nil, 0, false, err
+	}
+	kv := make(map[interface{}]interface{}, len(fields))
+	for field, value := range fields {
+		if field == hashPlaceholder {
+			continue
+		}
+		values, err := rp.Serializer().Deserialize([]byte(value))
+		if err != nil {
+			return nil, 0, false, err
+		}
+		for k, v := range values {
+			kv[k] = v
+		}
+	}
+	return kv, parseVersion(fields[hashPlaceholder]), len(fields) > 0, nil
+}
+
+// SessionExist check redis session exist by sid
+func (rp *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
+	c := withContext(rp.client, ctx)
+	if existed, err := c.Exists(sid).Result(); err != nil || existed == 0 {
+		return false, err
+	}
+	return true, nil
+}
+
+// SessionRegenerate generate new sid for redis session
+func (rp *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (session.Store, error) {
+	c := withContext(rp.client, ctx)
+
+	existed, err := c.Exists(oldsid).Result()
+	if err != nil {
+		return nil, err
+	}
+	if existed == 0 {
+		// oldsid doesn't exists, set the new sid directly
+		if err = c.Set(sid, "", time.Duration(rp.maxlifetime)*time.Second).Err(); err != nil {
+			return nil, err
+		}
+		return rp.SessionRead(ctx, sid)
+	}
+	if err = c.Rename(oldsid, sid).Err(); err != nil {
+		return nil, err
+	}
+	store, err := rp.SessionRead(ctx, sid)
+	if err != nil {
+		return nil, err
+	}
+	// the key keeps the lifetime of the session, see session.SetLifetime
+	rs := store.(*SessionStore)
+	if err = c.Expire(sid, rs.lifetime()).Err(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// SessionDestroy delete redis session by id
+func (rp *Provider) SessionDestroy(ctx context.Context, sid string) error {
+	c := withContext(rp.client, ctx)
+	return c.Del(sid).Err()
+}
+
+// SessionIndexUser add sid to the set of sessions of user, which expires
+// with the last of them, see session.UserIndexer
+func (rp *Provider) SessionIndexUser(ctx context.Context, user, sid string, created time.Time, lifetime time.Duration) error {
+	return indexScript.Run(withContext(rp.client, ctx), []string{userIndexPrefix + user},
+		int64(lifetime/time.Second), created.Unix(), sid).Err()
+}
+
+// SessionUnindexUser remove sid from the set of sessions of user
+func (rp *Provider) SessionUnindexUser(ctx context.Context, user, sid string) error {
+	return withContext(rp.client, ctx).ZRem(userIndexPrefix+user, sid).Err()
+}
+
+// SessionsOfUser return the sessions of user, oldest first
+func (rp *Provider) SessionsOfUser(ctx context.Context, user string) ([]string, error) {
+	return withContext(rp.client, ctx).ZRange(userIndexPrefix+user, 0, -1).Result()
+}
+
+// SessionUserIndexed report whether sid is one of the sessions of user
+func (rp *Provider) SessionUserIndexed(ctx context.Context, user, sid string) (bool, error) {
+	err := withContext(rp.client, ctx).ZScore(userIndexPrefix+user, sid).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SessionGC Impelment method, no used.
+func (rp *Provider) SessionGC(context.Context) {
+}
+
+// SessionAll return all activeSession
+func (rp *Provider) SessionAll(context.Context) int {
+	return 0
+}
+
+// SessionLock lock the session with SET NX PX, see session.SessionLocker.
+// The lock expires after ttl if it is not released.
+func (rp *Provider) SessionLock(ctx context.Context, sid string, ttl time.Duration) (func(context.Context) error, error) {
+	key := sid + lockSuffix
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	err := session.WaitLock(ctx, func() (bool, error) {
+		return withContext(rp.client, ctx).SetNX(key, token, ttl).Result()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		return unlockScript.Run(withContext(rp.client, ctx), []string{key}, token).Err()
+	}, nil
+}
+
+// unlockScript deletes a lock only if it's still held with the token
+var unlockScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// indexScript adds the session ARGV[3] created at ARGV[2], if given, to the
+// sessions of a user and extends their expiry to the lifetime ARGV[1]
+var indexScript = redis.NewScript(`if ARGV[3] then redis.call("ZADD", KEYS[1], ARGV[2], ARGV[3]) end local ttl = redis.call("TTL", KEYS[1]) if ttl ~= -2 and ttl < tonumber(ARGV[1]) then redis.call("EXPIRE", KEYS[1], ARGV[1]) end return 0`)
+
+// hashField returns the field of key in the session hash
+func hashField(key interface{}) string {
+	return fmt.Sprintf("%T:%v", key, key)
+}
+
+// storedVersion returns the version of the stored session, 0 if it doesn't exist
+func storedVersion(tx *redis.Tx, sid string) (uint64, error) {
+	kind, err := tx.Type(sid).Result()
+	if err != nil {
+		return 0, err
+	}
+	switch kind {
+	case "hash":
+		v, err := tx.HGet(sid, hashPlaceholder).Result()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		return parseVersion(v), nil
+	case "string":
+		b, err := tx.Get(sid).Bytes()
+		if err != nil && err != redis.Nil {
+			return 0, err
+		}
+		version, _ := session.DecodeVersion(b)
+		return version, nil
+	}
+	return 0, nil
+}
+
+// parseVersion parses the version held by the placeholder of a session hash
+func parseVersion(v string) uint64 {
+	version, _ := strconv.ParseUint(v, 10, 64)
+	return version
+}
+
+func isWrongType(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "WRONGTYPE")
+}
+
+// withContext binds ctx to the client, so that its commands honour
+// cancellation and deadlines of the caller
+func withContext(c redis.UniversalClient, ctx context.Context) redis.UniversalClient {
+	switch c := c.(type) {
+	case *redis.Client:
+		return c.WithContext(ctx)
+	case *redis.ClusterClient:
+		return c.WithContext(ctx)
+	}
+	return c
+}
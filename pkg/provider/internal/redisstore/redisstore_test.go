@@ -0,0 +1,303 @@
+package redisstore
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/stretchr/testify/assert"
+
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+// testProvider connects to the redis server at the address it is configured with
+type testProvider struct {
+	Provider
+}
+
+func (p *testProvider) SessionInit(ctx context.Context, maxlifetime int64, addr string) error {
+	return p.Init(ctx, redis.NewClient(&redis.Options{Addr: addr}), maxlifetime, "")
+}
+
+func init() {
+	session.Register("redisstore", &testProvider{})
+}
+
+// redisAddr returns the address of the redis server the tests use
+func redisAddr() string {
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		return addr
+	}
+	return "127.0.0.1:6379"
+}
+
+// newProvider returns a provider with layout, and skips the test without a
+// redis server
+func newProvider(t *testing.T, layout string, check bool) *Provider {
+	p := &Provider{}
+	p.SetVersionCheck(check)
+	if err := p.Init(context.Background(), redis.NewClient(&redis.Options{Addr: redisAddr()}), 3600, layout); err != nil {
+		t.Skip("redis is not available:", err)
+	}
+	return p
+}
+
+// newManager returns a manager of the redis server, and skips the test
+// without one
+func newManager(t *testing.T, config *session.ManagerConfig) (*session.Manager, *Provider) {
+	config.CookieName = "bsessionid"
+	config.Gclifetime = 3600
+	config.ProviderConfig = redisAddr()
+	manager, err := session.NewManager("redisstore", config)
+	if err != nil {
+		t.Skip("redis is not available:", err)
+	}
+	return manager, &manager.GetProvider().(*testProvider).Provider
+}
+
+func TestHashLayout(t *testing.T) {
+	ctx := context.Background()
+
+	// a session written with the string layout
+	sp := newProvider(t, LayoutString, false)
+	sess, err := sp.SessionRead(ctx, "hashlayout")
+	if err != nil {
+		t.Fatal("session read failed:", err)
+	}
+	defer sp.SessionDestroy(ctx, "hashlayout")
+	sess.Set(ctx, "username", "bhojpur")
+	if err = sess.SessionRelease(ctx, nil); err != nil {
+		t.Fatal("release failed:", err)
+	}
+
+	hp := newProvider(t, LayoutHash, false)
+	first, err := hp.SessionRead(ctx, "hashlayout")
+	if err != nil {
+		t.Fatal("session read failed:", err)
+	}
+	if username, _ := first.Get(ctx, "username"); username != "bhojpur" {
+		t.Fatal("session of string layout not read")
+	}
+	if err = first.SessionRelease(ctx, nil); err != nil {
+		t.Fatal("release failed:", err)
+	}
+
+	// concurrent requests keep each other's changes of other keys
+	first, _ = hp.SessionRead(ctx, "hashlayout")
+	second, _ := hp.SessionRead(ctx, "hashlayout")
+	first.Set(ctx, "cart", "book")
+	second.Set(ctx, "theme", "dark")
+	second.Delete(ctx, "username")
+	if err = first.SessionRelease(ctx, nil); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	if err = second.SessionRelease(ctx, nil); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	sess, _ = hp.SessionRead(ctx, "hashlayout")
+	values := sess.(*SessionStore).values
+	assert.Equal(t, map[interface{}]interface{}{"cart": "book", "theme": "dark"}, values)
+
+	// sessions without values exist
+	sess, _ = hp.SessionRead(ctx, "hashlayout-empty")
+	defer hp.SessionDestroy(ctx, "hashlayout-empty")
+	if err = sess.SessionRelease(ctx, nil); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	if exists, _ := hp.SessionExist(ctx, "hashlayout-empty"); !exists {
+		t.Fatal("empty session does not exist")
+	}
+
+	if ValidLayout("list") {
+		t.Fatal("expected unknown layout to be invalid")
+	}
+}
+
+func TestSessionLock(t *testing.T) {
+	ctx := context.Background()
+	p := newProvider(t, "", false)
+
+	unlock, err := p.SessionLock(ctx, "locked", time.Minute)
+	if err != nil {
+		t.Fatal("lock failed:", err)
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err = p.SessionLock(waitCtx, "locked", time.Minute); err != context.DeadlineExceeded {
+		t.Fatal("expected the lock to be held, got", err)
+	}
+	if err = unlock(ctx); err != nil {
+		t.Fatal("unlock failed:", err)
+	}
+	unlock, err = p.SessionLock(ctx, "locked", time.Minute)
+	if err != nil {
+		t.Fatal("lock failed:", err)
+	}
+	unlock(ctx)
+}
+
+func TestVersionCheck(t *testing.T) {
+	ctx := context.Background()
+
+	for _, layout := range []string{LayoutString, LayoutHash} {
+		rp := newProvider(t, layout, true)
+		sid := "versioned-" + layout
+		defer rp.SessionDestroy(ctx, sid)
+
+		first, _ := rp.SessionRead(ctx, sid)
+		second, _ := rp.SessionRead(ctx, sid)
+		first.Set(ctx, "cart", "book")
+		second.Set(ctx, "cart", "pen")
+		if err := first.SessionRelease(ctx, nil); err != nil {
+			t.Fatal("release failed:", err)
+		}
+		if err := second.SessionRelease(ctx, nil); err != session.ErrSessionConflict {
+			t.Fatalf("%s: expected a conflict, got %v", layout, err)
+		}
+
+		// the first request may release again
+		first.Set(ctx, "theme", "dark")
+		if err := first.SessionRelease(ctx, nil); err != nil {
+			t.Fatal("release failed:", err)
+		}
+		sess, _ := rp.SessionRead(ctx, sid)
+		assert.Equal(t, uint64(2), sess.(*SessionStore).version)
+		assert.Equal(t, map[interface{}]interface{}{"cart": "book", "theme": "dark"}, sess.(*SessionStore).values)
+		sess.Set(ctx, "cart", "pen")
+		if err := sess.SessionRelease(ctx, nil); err != nil {
+			t.Fatal("release failed:", err)
+		}
+	}
+}
+
+func TestSessionLifetime(t *testing.T) {
+	ctx := context.Background()
+	p := newProvider(t, "", false)
+
+	sess, err := p.SessionRead(ctx, "remembered")
+	if err != nil {
+		t.Fatal("session read failed:", err)
+	}
+	defer p.SessionDestroy(ctx, "remembered")
+	session.SetLifetime(ctx, sess, 30*24*time.Hour)
+	if err = sess.SessionRelease(ctx, nil); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	ttl, err := p.client.TTL("remembered").Result()
+	if err != nil {
+		t.Fatal("ttl failed:", err)
+	}
+	assert.Equal(t, 30*24*time.Hour, ttl)
+
+	// a regenerated session keeps its lifetime
+	if _, err = p.SessionRegenerate(ctx, "remembered", "remembered-new"); err != nil {
+		t.Fatal("regenerate failed:", err)
+	}
+	defer p.SessionDestroy(ctx, "remembered-new")
+	ttl, err = p.client.TTL("remembered-new").Result()
+	if err != nil {
+		t.Fatal("ttl failed:", err)
+	}
+	assert.Equal(t, 30*24*time.Hour, ttl)
+}
+
+func TestUserIndex(t *testing.T) {
+	manager, p := newManager(t, &session.ManagerConfig{})
+	ctx := context.Background()
+	key := userIndexPrefix + "alice"
+	defer p.client.Del(key)
+
+	sess, err := manager.SessionRegenerateWithID(ctx, "")
+	if err != nil {
+		t.Fatal("session start failed:", err)
+	}
+	if err = manager.SetSessionUser(ctx, sess, "alice"); err != nil {
+		t.Fatal("set user failed:", err)
+	}
+	if err = manager.SessionRelease(ctx, nil, sess); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	ttl, err := p.client.TTL(key).Result()
+	if err != nil {
+		t.Fatal("ttl failed:", err)
+	}
+	assert.Equal(t, time.Hour, ttl)
+
+	oldsid := sess.SessionID(ctx)
+	if sess, err = manager.SessionRegenerateWithID(ctx, oldsid); err != nil {
+		t.Fatal("regenerate failed:", err)
+	}
+	sids, err := manager.UserSessions(ctx, "alice")
+	if err != nil {
+		t.Fatal("user sessions failed:", err)
+	}
+	assert.Equal(t, []string{sess.SessionID(ctx)}, sids)
+	indexed, err := p.SessionUserIndexed(ctx, "alice", sess.SessionID(ctx))
+	assert.Nil(t, err)
+	assert.True(t, indexed)
+	indexed, err = p.SessionUserIndexed(ctx, "alice", oldsid)
+	assert.Nil(t, err)
+	assert.False(t, indexed)
+
+	if err = manager.DestroyUserSessions(ctx, "alice"); err != nil {
+		t.Fatal("destroy user sessions failed:", err)
+	}
+	if exists, _ := p.SessionExist(ctx, sess.SessionID(ctx)); exists {
+		t.Fatal("session of user was not destroyed")
+	}
+	if sids, _ = manager.UserSessions(ctx, "alice"); len(sids) != 0 {
+		t.Fatal("unexpected sessions of user", sids)
+	}
+}
+
+func TestUserSessionLimit(t *testing.T) {
+	manager, p := newManager(t, &session.ManagerConfig{
+		MaxUserSessions:   1,
+		UserSessionPolicy: session.EvictOldestSession,
+	})
+	ctx := context.Background()
+	defer manager.DestroyUserSessions(ctx, "dave")
+
+	var sids []string
+	for i := 0; i < 2; i++ {
+		sess, err := manager.SessionRegenerateWithID(ctx, "")
+		if err != nil {
+			t.Fatal("session start failed:", err)
+		}
+		sess.Set(ctx, session.CreatedKey, time.Now().Add(time.Duration(i-2)*time.Hour).Unix())
+		if err = manager.SetSessionUser(ctx, sess, "dave"); err != nil {
+			t.Fatal("set user failed:", err)
+		}
+		if err = manager.SessionRelease(ctx, nil, sess); err != nil {
+			t.Fatal("release failed:", err)
+		}
+		sids = append(sids, sess.SessionID(ctx))
+	}
+	if exists, _ := p.SessionExist(ctx, sids[0]); exists {
+		t.Fatal("oldest session was not evicted")
+	}
+	got, _ := manager.UserSessions(ctx, "dave")
+	assert.Equal(t, sids[1:], got)
+}
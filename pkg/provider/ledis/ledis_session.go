@@ -45,6 +45,7 @@ type SessionStore struct {
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
 	maxlifetime int64
+	serializer  session.Serializer
 }
 
 // Set value in ledis session
@@ -56,13 +57,24 @@ func (ls *SessionStore) Set(ctx context.Context, key, value interface{}) error {
 }
 
 // Get value in ledis session
-func (ls *SessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (ls *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	ls.lock.RLock()
 	defer ls.lock.RUnlock()
 	if v, ok := ls.values[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in ledis session
+func (ls *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	ls.lock.RLock()
+	defer ls.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(ls.values))
+	for k, v := range ls.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete value in ledis session
@@ -87,17 +99,22 @@ func (ls *SessionStore) SessionID(context.Context) string {
 }
 
 // SessionRelease save session values to ledis
-func (ls *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
-	b, err := session.EncodeGob(ls.values)
+func (ls *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	b, err := ls.serializer.Serialize(ls.values)
 	if err != nil {
-		return
+		return err
+	}
+	if err = c.Set([]byte(ls.sid), b); err != nil {
+		return err
 	}
-	c.Set([]byte(ls.sid), b)
-	c.Expire([]byte(ls.sid), ls.maxlifetime)
+	_, err = c.Expire([]byte(ls.sid), session.ValuesLifetime(ls.values, ls.maxlifetime))
+	return err
 }
 
 // Provider ledis session provider
 type Provider struct {
+	session.ProviderSerializer
+
 	maxlifetime int64
 	SavePath    string `json:"save_path"`
 	Db          int    `json:"db"`
@@ -159,12 +176,12 @@ func (lp *Provider) SessionRead(ctx context.Context, sid string) (session.Store,
 	if len(kvs) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		if kv, err = session.DecodeGob(kvs); err != nil {
+		if kv, err = lp.Serializer().Deserialize(kvs); err != nil {
 			return nil, err
 		}
 	}
 
-	ls := &SessionStore{sid: sid, values: kv, maxlifetime: lp.maxlifetime}
+	ls := &SessionStore{sid: sid, values: kv, maxlifetime: lp.maxlifetime, serializer: lp.Serializer()}
 	return ls, nil
 }
 
@@ -36,10 +36,12 @@ package memcache
 //	}
 
 import (
+	"bytes"
 	"context"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	session "github.com/bhojpur/session/pkg/engine"
 
@@ -54,7 +56,13 @@ type SessionStore struct {
 	sid         string
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
+	dirty       bool
 	maxlifetime int64
+	serializer  session.Serializer
+
+	// version checks, see session.ErrSessionConflict
+	check bool
+	item  *memcache.Item // item as read or last written, nil for new sessions
 }
 
 // Set value in memcache session
@@ -62,17 +70,29 @@ func (rs *SessionStore) Set(ctx context.Context, key, value interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values[key] = value
+	rs.dirty = true
 	return nil
 }
 
 // Get value in memcache session
-func (rs *SessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (rs *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	rs.lock.RLock()
 	defer rs.lock.RUnlock()
 	if v, ok := rs.values[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in memcache session
+func (rs *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(rs.values))
+	for k, v := range rs.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete value in memcache session
@@ -80,6 +100,7 @@ func (rs *SessionStore) Delete(ctx context.Context, key interface{}) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	delete(rs.values, key)
+	rs.dirty = true
 	return nil
 }
 
@@ -88,6 +109,7 @@ func (rs *SessionStore) Flush(context.Context) error {
 	rs.lock.Lock()
 	defer rs.lock.Unlock()
 	rs.values = make(map[interface{}]interface{})
+	rs.dirty = true
 	return nil
 }
 
@@ -96,18 +118,83 @@ func (rs *SessionStore) SessionID(context.Context) string {
 	return rs.sid
 }
 
-// SessionRelease save session values to memcache
-func (rs *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
-	b, err := session.EncodeGob(rs.values)
+// SessionRelease save session values to memcache.
+// Sessions which were not modified only have their expiry refreshed.
+func (rs *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if !rs.dirty {
+		err := session.RunWithContext(ctx, func() error {
+			return client.Touch(rs.sid, rs.expiration())
+		})
+		if err == memcache.ErrCacheMiss {
+			return nil
+		}
+		return err
+	}
+	b, err := rs.serializer.Serialize(rs.values)
 	if err != nil {
-		return
+		return err
+	}
+	item := memcache.Item{Key: rs.sid, Value: b, Expiration: rs.expiration()}
+	if rs.check {
+		return rs.releaseVersion(ctx, &item)
+	}
+	err = session.RunWithContext(ctx, func() error {
+		return client.Set(&item)
+	})
+	if err == nil {
+		rs.dirty = false
+	}
+	return err
+}
+
+// expiration returns the memcache expiration of the session, see
+// session.SetLifetime. Expirations beyond 30 days must be Unix times.
+func (rs *SessionStore) expiration() int32 {
+	lifetime := session.ValuesLifetime(rs.values, rs.maxlifetime)
+	if lifetime > 30*24*60*60 {
+		lifetime += time.Now().Unix()
+	}
+	return int32(lifetime)
+}
+
+// releaseVersion writes item with compare-and-swap, so that it's only written
+// if no other request wrote the session since it was read
+func (rs *SessionStore) releaseVersion(ctx context.Context, item *memcache.Item) error {
+	err := session.RunWithContext(ctx, func() error {
+		if rs.item == nil {
+			return client.Add(item)
+		}
+		cas := *rs.item
+		cas.Value, cas.Expiration = item.Value, item.Expiration
+		return client.CompareAndSwap(&cas)
+	})
+	switch err {
+	case nil:
+	case memcache.ErrCASConflict, memcache.ErrNotStored, memcache.ErrCacheMiss:
+		return session.ErrSessionConflict
+	default:
+		return err
 	}
-	item := memcache.Item{Key: rs.sid, Value: b, Expiration: int32(rs.maxlifetime)}
-	client.Set(&item)
+	rs.dirty = false
+	// the next release needs the new CAS ID, which is only returned by Get.
+	// If the session was written again in between, it keeps conflicting.
+	session.RunWithContext(ctx, func() error {
+		written, err := client.Get(rs.sid)
+		if err == nil && bytes.Equal(written.Value, item.Value) {
+			rs.item = written
+		}
+		return err
+	})
+	return nil
 }
 
 // MemProvider memcache session provider
 type MemProvider struct {
+	session.ProviderSerializer
+	session.ProviderVersionCheck
+
 	maxlifetime int64
 	conninfo    []string
 	poolsize    int
@@ -131,10 +218,16 @@ func (rp *MemProvider) SessionRead(ctx context.Context, sid string) (session.Sto
 			return nil, err
 		}
 	}
-	item, err := client.Get(sid)
+	var item *memcache.Item
+	err := session.RunWithContext(ctx, func() (err error) {
+		item, err = client.Get(sid)
+		return err
+	})
 	if err != nil {
 		if err == memcache.ErrCacheMiss {
-			rs := &SessionStore{sid: sid, values: make(map[interface{}]interface{}), maxlifetime: rp.maxlifetime}
+			// new sessions are written on release even without values
+			rs := &SessionStore{sid: sid, values: make(map[interface{}]interface{}), dirty: true, maxlifetime: rp.maxlifetime, serializer: rp.Serializer(),
+				check: rp.VersionCheck()}
 			return rs, nil
 		}
 		return nil, err
@@ -143,12 +236,13 @@ func (rp *MemProvider) SessionRead(ctx context.Context, sid string) (session.Sto
 	if len(item.Value) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob(item.Value)
+		kv, err = rp.Serializer().Deserialize(item.Value)
 		if err != nil {
 			return nil, err
 		}
 	}
-	rs := &SessionStore{sid: sid, values: kv, maxlifetime: rp.maxlifetime}
+	rs := &SessionStore{sid: sid, values: kv, maxlifetime: rp.maxlifetime, serializer: rp.Serializer(),
+		check: rp.VersionCheck(), item: item}
 	return rs, nil
 }
 
@@ -159,7 +253,15 @@ func (rp *MemProvider) SessionExist(ctx context.Context, sid string) (bool, erro
 			return false, err
 		}
 	}
-	if item, err := client.Get(sid); err != nil || len(item.Value) == 0 {
+	var item *memcache.Item
+	err := session.RunWithContext(ctx, func() (err error) {
+		item, err = client.Get(sid)
+		return err
+	})
+	if err == memcache.ErrCacheMiss {
+		return false, nil
+	}
+	if err != nil || len(item.Value) == 0 {
 		return false, err
 	}
 	return true, nil
@@ -172,35 +274,44 @@ func (rp *MemProvider) SessionRegenerate(ctx context.Context, oldsid, sid string
 			return nil, err
 		}
 	}
-	var contain []byte
-	if item, err := client.Get(sid); err != nil || len(item.Value) == 0 {
-		// oldsid doesn't exists, set the new sid directly
-		// ignore error here, since if it return error
-		// the existed value will be 0
-		item.Key = sid
-		item.Value = []byte("")
-		item.Expiration = int32(rp.maxlifetime)
-		client.Set(item)
-	} else {
-		client.Delete(oldsid)
-		item.Key = sid
-		item.Expiration = int32(rp.maxlifetime)
-		client.Set(item)
-		contain = item.Value
-	}
-
-	var kv map[interface{}]interface{}
-	if len(contain) == 0 {
-		kv = make(map[interface{}]interface{})
-	} else {
-		var err error
-		kv, err = session.DecodeGob(contain)
-		if err != nil {
-			return nil, err
+	var rs *SessionStore
+	err := session.RunWithContext(ctx, func() error {
+		old, err := client.Get(oldsid)
+		if err != nil && err != memcache.ErrCacheMiss {
+			return err
+		}
+		store := &SessionStore{sid: sid, values: make(map[interface{}]interface{}), maxlifetime: rp.maxlifetime, serializer: rp.Serializer(),
+			check: rp.VersionCheck()}
+		// the new sid is set empty if oldsid doesn't exist
+		item := &memcache.Item{Key: sid, Value: []byte("")}
+		exists := err == nil && len(old.Value) > 0
+		if exists {
+			if store.values, err = store.serializer.Deserialize(old.Value); err != nil {
+				return err
+			}
+			item.Value, item.Flags = old.Value, old.Flags
+		}
+		// the new item keeps the lifetime of the session, see session.SetLifetime
+		item.Expiration = store.expiration()
+		if err = client.Set(item); err != nil {
+			return err
 		}
+		if exists {
+			if err = client.Delete(oldsid); err != nil && err != memcache.ErrCacheMiss {
+				return err
+			}
+		}
+		store.item = item
+		rs = store
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rp.VersionCheck() {
+		// the store needs the CAS ID of the new item
+		return rp.SessionRead(ctx, sid)
 	}
-
-	rs := &SessionStore{sid: sid, values: kv, maxlifetime: rp.maxlifetime}
 	return rs, nil
 }
 
@@ -212,7 +323,9 @@ func (rp *MemProvider) SessionDestroy(ctx context.Context, sid string) error {
 		}
 	}
 
-	return client.Delete(sid)
+	return session.RunWithContext(ctx, func() error {
+		return client.Delete(sid)
+	})
 }
 
 func (rp *MemProvider) connectInit() error {
@@ -32,6 +32,13 @@ package mysql
 //	PRIMARY KEY (`session_key`)
 //	) ENGINE=MyISAM DEFAULT CHARSET=utf8;
 //
+// version checks (see session.CfgVersionCheck) need the column:
+//	ALTER TABLE `session` ADD `session_version` bigint NOT NULL DEFAULT 0;
+//
+// finding the sessions of users (see session.UserIndexer) needs the column:
+//	ALTER TABLE `session` ADD `session_user_id` varchar(255), ADD `session_user_created` bigint,
+//	ADD INDEX (`session_user_id`);
+//
 // Usage:
 // import(
 //   _ "github.com/bhojpur/session/pkg/provider/mysql"
@@ -45,7 +52,10 @@ package mysql
 
 import (
 	"context"
+	"crypto/sha1"
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"sync"
 	"time"
@@ -63,10 +73,15 @@ var (
 
 // SessionStore mysql session store
 type SessionStore struct {
-	c      *sql.DB
-	sid    string
-	lock   sync.RWMutex
-	values map[interface{}]interface{}
+	c           *sql.DB
+	sid         string
+	lock        sync.RWMutex
+	values      map[interface{}]interface{}
+	dirty       bool
+	serializer  session.Serializer
+	check       bool  // see session.ErrSessionConflict
+	version     int64 // version of the session when it was read
+	maxlifetime int64
 }
 
 // Set value in mysql session.
@@ -75,17 +90,29 @@ func (st *SessionStore) Set(ctx context.Context, key, value interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	st.values[key] = value
+	st.dirty = true
 	return nil
 }
 
 // Get value from mysql session
-func (st *SessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (st *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	st.lock.RLock()
 	defer st.lock.RUnlock()
 	if v, ok := st.values[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in mysql session
+func (st *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.values))
+	for k, v := range st.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete value in mysql session
@@ -93,6 +120,7 @@ func (st *SessionStore) Delete(ctx context.Context, key interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	delete(st.values, key)
+	st.dirty = true
 	return nil
 }
 
@@ -101,6 +129,7 @@ func (st *SessionStore) Flush(context.Context) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	st.values = make(map[interface{}]interface{})
+	st.dirty = true
 	return nil
 }
 
@@ -111,22 +140,93 @@ func (st *SessionStore) SessionID(context.Context) string {
 
 // SessionRelease save mysql session values to database.
 // must call this method to save values to database.
-func (st *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
+// Sessions which were not modified only have their expiry refreshed.
+func (st *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
 	defer st.c.Close()
-	b, err := session.EncodeGob(st.values)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if !st.dirty {
+		_, err := st.c.ExecContext(ctx, "UPDATE "+TableName+" set `session_expiry`=? where session_key=?",
+			st.expiry(), st.sid)
+		return err
+	}
+	b, err := st.serializer.Serialize(st.values)
 	if err != nil {
-		return
+		return err
+	}
+	if !st.check {
+		_, err = st.c.ExecContext(ctx, "UPDATE "+TableName+" set `session_data`=?, `session_expiry`=? where session_key=?",
+			b, st.expiry(), st.sid)
+		if err == nil {
+			st.dirty = false
+		}
+		return err
 	}
-	st.c.Exec("UPDATE "+TableName+" set `session_data`=?, `session_expiry`=? where session_key=?",
-		b, time.Now().Unix(), st.sid)
+	// the session is only written if no other request did since it was read
+	res, err := st.c.ExecContext(ctx, "UPDATE "+TableName+" set `session_data`=?, `session_expiry`=?, `session_version`=`session_version`+1 where session_key=? and `session_version`=?",
+		b, st.expiry(), st.sid, st.version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return session.ErrSessionConflict
+	}
+	st.dirty = false
+	st.version++
+	return nil
+}
+
+// expiry returns the session_expiry of the session. SessionGC removes
+// sessions maxlifetime after it, so it's shifted for sessions with their own
+// lifetime, see session.SetLifetime.
+func (st *SessionStore) expiry() int64 {
+	return time.Now().Unix() + session.ValuesLifetime(st.values, st.maxlifetime) - st.maxlifetime
 }
 
 // Provider mysql session provider
 type Provider struct {
+	session.ProviderSerializer
+	session.ProviderVersionCheck
+
 	maxlifetime int64
 	savePath    string
 }
 
+// SessionLock lock the session with GET_LOCK on a dedicated connection, see
+// session.SessionLocker. ttl is not supported, the lock is released when the
+// connection is closed.
+func (mp *Provider) SessionLock(ctx context.Context, sid string, ttl time.Duration) (func(context.Context) error, error) {
+	db := mp.connectInit()
+	if db == nil {
+		return nil, errors.New("mysql: cannot open database")
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	// lock names are limited to 64 characters
+	name := fmt.Sprintf("session:%x", sha1.Sum([]byte(sid)))
+	err = session.WaitLock(ctx, func() (bool, error) {
+		var locked sql.NullInt64
+		err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&locked)
+		return locked.Int64 == 1, err
+	})
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		defer db.Close()
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+		return err
+	}, nil
+}
+
 // connect to mysql
 func (mp *Provider) connectInit() *sql.DB {
 	db, e := sql.Open("mysql", mp.savePath)
@@ -147,31 +247,45 @@ func (mp *Provider) SessionInit(ctx context.Context, maxlifetime int64, savePath
 // SessionRead get mysql session by sid
 func (mp *Provider) SessionRead(ctx context.Context, sid string) (session.Store, error) {
 	c := mp.connectInit()
-	row := c.QueryRow("select session_data from "+TableName+" where session_key=?", sid)
-	var sessiondata []byte
-	err := row.Scan(&sessiondata)
+	sessiondata, version, err := mp.readData(ctx, c, sid)
 	if err == sql.ErrNoRows {
-		c.Exec("insert into "+TableName+"(`session_key`,`session_data`,`session_expiry`) values(?,?,?)",
+		_, err = c.ExecContext(ctx, "insert into "+TableName+"(`session_key`,`session_data`,`session_expiry`) values(?,?,?)",
 			sid, "", time.Now().Unix())
 	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
 	var kv map[interface{}]interface{}
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob(sessiondata)
+		kv, err = mp.Serializer().Deserialize(sessiondata)
 		if err != nil {
+			c.Close()
 			return nil, err
 		}
 	}
-	rs := &SessionStore{c: c, sid: sid, values: kv}
+	rs := &SessionStore{c: c, sid: sid, values: kv, serializer: mp.Serializer(),
+		check: mp.VersionCheck(), version: version, maxlifetime: mp.maxlifetime}
 	return rs, nil
 }
 
+// readData reads the serialized session and, with version checks, its version
+func (mp *Provider) readData(ctx context.Context, c *sql.DB, sid string) (data []byte, version int64, err error) {
+	if mp.VersionCheck() {
+		err = c.QueryRowContext(ctx, "select session_data, session_version from "+TableName+" where session_key=?", sid).Scan(&data, &version)
+	} else {
+		err = c.QueryRowContext(ctx, "select session_data from "+TableName+" where session_key=?", sid).Scan(&data)
+	}
+	return
+}
+
 // SessionExist check mysql session exist
 func (mp *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
 	c := mp.connectInit()
 	defer c.Close()
-	row := c.QueryRow("select session_data from "+TableName+" where session_key=?", sid)
+	row := c.QueryRowContext(ctx, "select session_data from "+TableName+" where session_key=?", sid)
 	var sessiondata []byte
 	err := row.Scan(&sessiondata)
 	if err != nil {
@@ -186,47 +300,111 @@ func (mp *Provider) SessionExist(ctx context.Context, sid string) (bool, error)
 // SessionRegenerate generate new sid for mysql session
 func (mp *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (session.Store, error) {
 	c := mp.connectInit()
-	row := c.QueryRow("select session_data from "+TableName+" where session_key=?", oldsid)
-	var sessiondata []byte
-	err := row.Scan(&sessiondata)
+	sessiondata, version, err := mp.readData(ctx, c, oldsid)
 	if err == sql.ErrNoRows {
-		c.Exec("insert into "+TableName+"(`session_key`,`session_data`,`session_expiry`) values(?,?,?)", oldsid, "", time.Now().Unix())
+		_, err = c.ExecContext(ctx, "insert into "+TableName+"(`session_key`,`session_data`,`session_expiry`) values(?,?,?)", oldsid, "", time.Now().Unix())
+	}
+	if err == nil {
+		_, err = c.ExecContext(ctx, "update "+TableName+" set `session_key`=? where session_key=?", sid, oldsid)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
 	}
-	c.Exec("update "+TableName+" set `session_key`=? where session_key=?", sid, oldsid)
 	var kv map[interface{}]interface{}
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob(sessiondata)
+		kv, err = mp.Serializer().Deserialize(sessiondata)
 		if err != nil {
+			c.Close()
 			return nil, err
 		}
 	}
-	rs := &SessionStore{c: c, sid: sid, values: kv}
+	rs := &SessionStore{c: c, sid: sid, values: kv, serializer: mp.Serializer(),
+		check: mp.VersionCheck(), version: version, maxlifetime: mp.maxlifetime}
 	return rs, nil
 }
 
 // SessionDestroy delete mysql session by sid
 func (mp *Provider) SessionDestroy(ctx context.Context, sid string) error {
 	c := mp.connectInit()
-	c.Exec("DELETE FROM "+TableName+" where session_key=?", sid)
-	c.Close()
-	return nil
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "DELETE FROM "+TableName+" where session_key=?", sid)
+	return err
 }
 
 // SessionGC delete expired values in mysql session
-func (mp *Provider) SessionGC(context.Context) {
+func (mp *Provider) SessionGC(ctx context.Context) {
+	if err := mp.SessionGCWithError(ctx); err != nil {
+		session.SLogger.Println(err)
+	}
+}
+
+// SessionGCWithError delete expired values in mysql session, see
+// session.GCWithError
+func (mp *Provider) SessionGCWithError(ctx context.Context) error {
 	c := mp.connectInit()
-	c.Exec("DELETE from "+TableName+" where session_expiry < ?", time.Now().Unix()-mp.maxlifetime)
-	c.Close()
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "DELETE from "+TableName+" where session_expiry < ?", time.Now().Unix()-mp.maxlifetime)
+	return err
+}
+
+// SessionIndexUser store user in the row of session sid, see
+// session.UserIndexer. The row expires with the session.
+func (mp *Provider) SessionIndexUser(ctx context.Context, user, sid string, created time.Time, lifetime time.Duration) error {
+	c := mp.connectInit()
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "UPDATE "+TableName+" set session_user_id=?, session_user_created=? where session_key=?", user, created.Unix(), sid)
+	return err
+}
+
+// SessionUnindexUser clear user from the row of session sid
+func (mp *Provider) SessionUnindexUser(ctx context.Context, user, sid string) error {
+	c := mp.connectInit()
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "UPDATE "+TableName+" set session_user_id=NULL where session_key=? and session_user_id=?", sid, user)
+	return err
+}
+
+// SessionsOfUser return the sessions of user, oldest first
+func (mp *Provider) SessionsOfUser(ctx context.Context, user string) ([]string, error) {
+	c := mp.connectInit()
+	defer c.Close()
+	rows, err := c.QueryContext(ctx, "SELECT session_key from "+TableName+" where session_user_id=? order by session_user_created, session_key", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sids []string
+	for rows.Next() {
+		var sid string
+		if err = rows.Scan(&sid); err != nil {
+			return nil, err
+		}
+		sids = append(sids, sid)
+	}
+	return sids, rows.Err()
+}
+
+// SessionUserIndexed report whether sid is one of the sessions of user
+func (mp *Provider) SessionUserIndexed(ctx context.Context, user, sid string) (bool, error) {
+	c := mp.connectInit()
+	defer c.Close()
+	var found int
+	err := c.QueryRowContext(ctx, "SELECT 1 from "+TableName+" where session_key=? and session_user_id=?", sid, user).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 // SessionAll count values in mysql session
-func (mp *Provider) SessionAll(context.Context) int {
+func (mp *Provider) SessionAll(ctx context.Context) int {
 	c := mp.connectInit()
 	defer c.Close()
 	var total int
-	err := c.QueryRow("SELECT count(*) as num from " + TableName).Scan(&total)
+	err := c.QueryRowContext(ctx, "SELECT count(*) as num from "+TableName).Scan(&total)
 	if err != nil {
 		return 0
 	}
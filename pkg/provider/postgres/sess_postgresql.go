@@ -33,6 +33,15 @@ package postgres
 // CONSTRAINT session_key PRIMARY KEY(session_key)
 // );
 //
+// version checks (see session.CfgVersionCheck) need the column:
+//
+// ALTER TABLE session ADD session_version bigint NOT NULL DEFAULT 0;
+//
+// finding the sessions of users (see session.UserIndexer) needs the column:
+//
+// ALTER TABLE session ADD session_user_id varchar(255), ADD session_user_created bigint;
+// CREATE INDEX session_user_id ON session(session_user_id);
+//
 // will be activated with these settings in app.conf:
 //
 // SessionOn = true
@@ -55,6 +64,7 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"net/http"
 	"sync"
 	"time"
@@ -68,10 +78,15 @@ var postgresqlpder = &Provider{}
 
 // SessionStore postgresql session store
 type SessionStore struct {
-	c      *sql.DB
-	sid    string
-	lock   sync.RWMutex
-	values map[interface{}]interface{}
+	c           *sql.DB
+	sid         string
+	lock        sync.RWMutex
+	values      map[interface{}]interface{}
+	dirty       bool
+	serializer  session.Serializer
+	check       bool  // see session.ErrSessionConflict
+	version     int64 // version of the session when it was read
+	maxlifetime int64
 }
 
 // Set value in postgresql session.
@@ -80,17 +95,29 @@ func (st *SessionStore) Set(ctx context.Context, key, value interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	st.values[key] = value
+	st.dirty = true
 	return nil
 }
 
 // Get value from postgresql session
-func (st *SessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (st *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	st.lock.RLock()
 	defer st.lock.RUnlock()
 	if v, ok := st.values[key]; ok {
-		return v
+		return v, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return a copy of all values in postgresql session
+func (st *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	st.lock.RLock()
+	defer st.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(st.values))
+	for k, v := range st.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete value in postgresql session
@@ -98,6 +125,7 @@ func (st *SessionStore) Delete(ctx context.Context, key interface{}) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	delete(st.values, key)
+	st.dirty = true
 	return nil
 }
 
@@ -106,6 +134,7 @@ func (st *SessionStore) Flush(context.Context) error {
 	st.lock.Lock()
 	defer st.lock.Unlock()
 	st.values = make(map[interface{}]interface{})
+	st.dirty = true
 	return nil
 }
 
@@ -116,23 +145,91 @@ func (st *SessionStore) SessionID(context.Context) string {
 
 // SessionRelease save postgresql session values to database.
 // must call this method to save values to database.
-func (st *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
+// Sessions which were not modified only have their expiry refreshed.
+func (st *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
 	defer st.c.Close()
-	b, err := session.EncodeGob(st.values)
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if !st.dirty {
+		_, err := st.c.ExecContext(ctx, "UPDATE session set session_expiry=$1 where session_key=$2",
+			st.expiry(), st.sid)
+		return err
+	}
+	b, err := st.serializer.Serialize(st.values)
+	if err != nil {
+		return err
+	}
+	if !st.check {
+		_, err = st.c.ExecContext(ctx, "UPDATE session set session_data=$1, session_expiry=$2 where session_key=$3",
+			b, st.expiry(), st.sid)
+		if err == nil {
+			st.dirty = false
+		}
+		return err
+	}
+	// the session is only written if no other request did since it was read
+	res, err := st.c.ExecContext(ctx, "UPDATE session set session_data=$1, session_expiry=$2, session_version=session_version+1 where session_key=$3 and session_version=$4",
+		b, st.expiry(), st.sid, st.version)
 	if err != nil {
-		return
+		return err
 	}
-	st.c.Exec("UPDATE session set session_data=$1, session_expiry=$2 where session_key=$3",
-		b, time.Now().Format(time.RFC3339), st.sid)
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return session.ErrSessionConflict
+	}
+	st.dirty = false
+	st.version++
+	return nil
+}
 
+// expiry returns the session_expiry of the session. SessionGC removes
+// sessions maxlifetime after it, so it's shifted for sessions with their own
+// lifetime, see session.SetLifetime.
+func (st *SessionStore) expiry() string {
+	shift := session.ValuesLifetime(st.values, st.maxlifetime) - st.maxlifetime
+	return time.Now().Add(time.Duration(shift) * time.Second).Format(time.RFC3339)
 }
 
 // Provider postgresql session provider
 type Provider struct {
+	session.ProviderSerializer
+	session.ProviderVersionCheck
+
 	maxlifetime int64
 	savePath    string
 }
 
+// SessionLock lock the session with an advisory lock of a dedicated
+// connection, see session.SessionLocker. ttl is not supported, the lock is
+// released when the connection is closed.
+func (mp *Provider) SessionLock(ctx context.Context, sid string, ttl time.Duration) (func(context.Context) error, error) {
+	db := mp.connectInit()
+	if db == nil {
+		return nil, errors.New("postgres: cannot open database")
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	err = session.WaitLock(ctx, func() (locked bool, err error) {
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", sid).Scan(&locked)
+		return locked, err
+	})
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, err
+	}
+	return func(ctx context.Context) error {
+		defer db.Close()
+		defer conn.Close()
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", sid)
+		return err
+	}, nil
+}
+
 // connect to postgresql
 func (mp *Provider) connectInit() *sql.DB {
 	db, e := sql.Open("postgres", mp.savePath)
@@ -153,17 +250,13 @@ func (mp *Provider) SessionInit(ctx context.Context, maxlifetime int64, savePath
 // SessionRead get postgresql session by sid
 func (mp *Provider) SessionRead(ctx context.Context, sid string) (session.Store, error) {
 	c := mp.connectInit()
-	row := c.QueryRow("select session_data from session where session_key=$1", sid)
-	var sessiondata []byte
-	err := row.Scan(&sessiondata)
+	sessiondata, version, err := mp.readData(ctx, c, sid)
 	if err == sql.ErrNoRows {
-		_, err = c.Exec("insert into session(session_key,session_data,session_expiry) values($1,$2,$3)",
+		_, err = c.ExecContext(ctx, "insert into session(session_key,session_data,session_expiry) values($1,$2,$3)",
 			sid, "", time.Now().Format(time.RFC3339))
-
-		if err != nil {
-			return nil, err
-		}
-	} else if err != nil {
+	}
+	if err != nil {
+		c.Close()
 		return nil, err
 	}
 
@@ -171,20 +264,32 @@ func (mp *Provider) SessionRead(ctx context.Context, sid string) (session.Store,
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob(sessiondata)
+		kv, err = mp.Serializer().Deserialize(sessiondata)
 		if err != nil {
+			c.Close()
 			return nil, err
 		}
 	}
-	rs := &SessionStore{c: c, sid: sid, values: kv}
+	rs := &SessionStore{c: c, sid: sid, values: kv, serializer: mp.Serializer(),
+		check: mp.VersionCheck(), version: version, maxlifetime: mp.maxlifetime}
 	return rs, nil
 }
 
+// readData reads the serialized session and, with version checks, its version
+func (mp *Provider) readData(ctx context.Context, c *sql.DB, sid string) (data []byte, version int64, err error) {
+	if mp.VersionCheck() {
+		err = c.QueryRowContext(ctx, "select session_data, session_version from session where session_key=$1", sid).Scan(&data, &version)
+	} else {
+		err = c.QueryRowContext(ctx, "select session_data from session where session_key=$1", sid).Scan(&data)
+	}
+	return
+}
+
 // SessionExist check postgresql session exist
 func (mp *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
 	c := mp.connectInit()
 	defer c.Close()
-	row := c.QueryRow("select session_data from session where session_key=$1", sid)
+	row := c.QueryRowContext(ctx, "select session_data from session where session_key=$1", sid)
 	var sessiondata []byte
 	err := row.Scan(&sessiondata)
 	if err != nil {
@@ -199,48 +304,113 @@ func (mp *Provider) SessionExist(ctx context.Context, sid string) (bool, error)
 // SessionRegenerate generate new sid for postgresql session
 func (mp *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (session.Store, error) {
 	c := mp.connectInit()
-	row := c.QueryRow("select session_data from session where session_key=$1", oldsid)
-	var sessiondata []byte
-	err := row.Scan(&sessiondata)
+	sessiondata, version, err := mp.readData(ctx, c, oldsid)
 	if err == sql.ErrNoRows {
-		c.Exec("insert into session(session_key,session_data,session_expiry) values($1,$2,$3)",
+		_, err = c.ExecContext(ctx, "insert into session(session_key,session_data,session_expiry) values($1,$2,$3)",
 			oldsid, "", time.Now().Format(time.RFC3339))
 	}
-	c.Exec("update session set session_key=$1 where session_key=$2", sid, oldsid)
+	if err == nil {
+		_, err = c.ExecContext(ctx, "update session set session_key=$1 where session_key=$2", sid, oldsid)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
 	var kv map[interface{}]interface{}
 	if len(sessiondata) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob(sessiondata)
+		kv, err = mp.Serializer().Deserialize(sessiondata)
 		if err != nil {
+			c.Close()
 			return nil, err
 		}
 	}
-	rs := &SessionStore{c: c, sid: sid, values: kv}
+	rs := &SessionStore{c: c, sid: sid, values: kv, serializer: mp.Serializer(),
+		check: mp.VersionCheck(), version: version, maxlifetime: mp.maxlifetime}
 	return rs, nil
 }
 
 // SessionDestroy delete postgresql session by sid
 func (mp *Provider) SessionDestroy(ctx context.Context, sid string) error {
 	c := mp.connectInit()
-	c.Exec("DELETE FROM session where session_key=$1", sid)
-	c.Close()
-	return nil
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "DELETE FROM session where session_key=$1", sid)
+	return err
 }
 
 // SessionGC delete expired values in postgresql session
-func (mp *Provider) SessionGC(context.Context) {
+func (mp *Provider) SessionGC(ctx context.Context) {
+	if err := mp.SessionGCWithError(ctx); err != nil {
+		session.SLogger.Println(err)
+	}
+}
+
+// SessionGCWithError delete expired values in postgresql session, see
+// session.GCWithError
+func (mp *Provider) SessionGCWithError(ctx context.Context) error {
+	c := mp.connectInit()
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "DELETE from session where EXTRACT(EPOCH FROM (current_timestamp - session_expiry)) > $1", mp.maxlifetime)
+	return err
+}
+
+// SessionIndexUser store user in the row of session sid, see
+// session.UserIndexer. The row expires with the session.
+func (mp *Provider) SessionIndexUser(ctx context.Context, user, sid string, created time.Time, lifetime time.Duration) error {
 	c := mp.connectInit()
-	c.Exec("DELETE from session where EXTRACT(EPOCH FROM (current_timestamp - session_expiry)) > $1", mp.maxlifetime)
-	c.Close()
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "UPDATE session set session_user_id=$1, session_user_created=$2 where session_key=$3", user, created.Unix(), sid)
+	return err
+}
+
+// SessionUnindexUser clear user from the row of session sid
+func (mp *Provider) SessionUnindexUser(ctx context.Context, user, sid string) error {
+	c := mp.connectInit()
+	defer c.Close()
+	_, err := c.ExecContext(ctx, "UPDATE session set session_user_id=NULL where session_key=$1 and session_user_id=$2", sid, user)
+	return err
+}
+
+// SessionsOfUser return the sessions of user, oldest first, without the padding of
+// session_key
+func (mp *Provider) SessionsOfUser(ctx context.Context, user string) ([]string, error) {
+	c := mp.connectInit()
+	defer c.Close()
+	rows, err := c.QueryContext(ctx, "SELECT rtrim(session_key) from session where session_user_id=$1 order by session_user_created, session_key", user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sids []string
+	for rows.Next() {
+		var sid string
+		if err = rows.Scan(&sid); err != nil {
+			return nil, err
+		}
+		sids = append(sids, sid)
+	}
+	return sids, rows.Err()
+}
+
+// SessionUserIndexed report whether sid is one of the sessions of user
+func (mp *Provider) SessionUserIndexed(ctx context.Context, user, sid string) (bool, error) {
+	c := mp.connectInit()
+	defer c.Close()
+	var found int
+	err := c.QueryRowContext(ctx, "SELECT 1 from session where session_key=$1 and session_user_id=$2", sid, user).Scan(&found)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
 }
 
 // SessionAll count values in postgresql session
-func (mp *Provider) SessionAll(context.Context) int {
+func (mp *Provider) SessionAll(ctx context.Context) int {
 	c := mp.connectInit()
 	defer c.Close()
 	var total int
-	err := c.QueryRow("SELECT count(*) as num from session").Scan(&total)
+	err := c.QueryRowContext(ctx, "SELECT count(*) as num from session").Scan(&total)
 	if err != nil {
 		return 0
 	}
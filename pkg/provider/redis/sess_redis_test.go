@@ -52,10 +52,12 @@ func TestRedis(t *testing.T) {
 	sessionConfig.ProviderConfig = fmt.Sprintf("%s,100,,0,30", redisAddr)
 	globalSession, err := session.NewManager("redis", sessionConfig)
 	if err != nil {
-		t.Fatal("could not create manager:", err)
+		t.Skip("redis is not available:", err)
 	}
 
-	go globalSession.GC()
+	gcCtx, stopGC := context.WithCancel(context.Background())
+	defer stopGC()
+	go globalSession.GCContext(gcCtx)
 
 	r, _ := http.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
@@ -64,14 +66,14 @@ func TestRedis(t *testing.T) {
 	if err != nil {
 		t.Fatal("session start failed:", err)
 	}
-	defer sess.SessionRelease(nil, w)
+	defer sess.SessionRelease(r.Context(), w)
 
 	// SET AND GET
 	err = sess.Set(nil, "username", "bhojpur")
 	if err != nil {
 		t.Fatal("set username failed:", err)
 	}
-	username := sess.Get(nil, "username")
+	username, _ := sess.Get(nil, "username")
 	if username != "bhojpur" {
 		t.Fatal("get username failed")
 	}
@@ -81,7 +83,7 @@ func TestRedis(t *testing.T) {
 	if err != nil {
 		t.Fatal("delete username failed:", err)
 	}
-	username = sess.Get(nil, "username")
+	username, _ = sess.Get(nil, "username")
 	if username != nil {
 		t.Fatal("delete username failed")
 	}
@@ -95,11 +97,11 @@ func TestRedis(t *testing.T) {
 	if err != nil {
 		t.Fatal("set failed:", err)
 	}
-	username = sess.Get(nil, "username")
+	username, _ = sess.Get(nil, "username")
 	if username != "bhojpur" {
 		t.Fatal("get username failed")
 	}
-	password := sess.Get(nil, "password")
+	password, _ := sess.Get(nil, "password")
 	if password != "1qaz2wsx" {
 		t.Fatal("get password failed")
 	}
@@ -107,16 +109,36 @@ func TestRedis(t *testing.T) {
 	if err != nil {
 		t.Fatal("flush failed:", err)
 	}
-	username = sess.Get(nil, "username")
+	username, _ = sess.Get(nil, "username")
 	if username != nil {
 		t.Fatal("flush failed")
 	}
-	password = sess.Get(nil, "password")
+	password, _ = sess.Get(nil, "password")
 	if password != nil {
 		t.Fatal("flush failed")
 	}
 
-	sess.SessionRelease(nil, w)
+	sess.SessionRelease(r.Context(), w)
+
+	// releasing an unchanged session does not overwrite a concurrent write
+	ctx := r.Context()
+	sid := sess.SessionID(ctx)
+	reader, err := redispder.SessionRead(ctx, sid)
+	if err != nil {
+		t.Fatal("session read failed:", err)
+	}
+	writer, _ := redispder.SessionRead(ctx, sid)
+	writer.Set(ctx, "username", "bhojpur")
+	if err = writer.SessionRelease(ctx, w); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	if err = reader.SessionRelease(ctx, w); err != nil {
+		t.Fatal("release failed:", err)
+	}
+	reader, _ = redispder.SessionRead(ctx, sid)
+	if username, _ = reader.Get(ctx, "username"); username != "bhojpur" {
+		t.Fatal("unchanged session overwrote the session")
+	}
 }
 
 func TestProvider_SessionInit(t *testing.T) {
@@ -129,4 +151,8 @@ func TestProvider_SessionInit(t *testing.T) {
 	assert.Equal(t, "my save path", cp.SavePath)
 	assert.Equal(t, 3*time.Second, cp.idleTimeout)
 	assert.Equal(t, int64(12), cp.maxlifetime)
+
+	if err := (&Provider{}).SessionInit(context.Background(), 3600, `{"save_path":"my save path","idle_timeout":"30s","idle_check_frequency":"30s","layout":"list"}`); err == nil {
+		t.Fatal("expected error for unknown layout")
+	}
 }
@@ -38,15 +38,15 @@ package redis_cluster
 import (
 	"context"
 	"encoding/json"
-	"net/http"
+	"errors"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	rediss "github.com/go-redis/redis/v7"
 
 	session "github.com/bhojpur/session/pkg/engine"
+	"github.com/bhojpur/session/pkg/provider/internal/redisstore"
 )
 
 var redispder = &Provider{}
@@ -54,66 +54,22 @@ var redispder = &Provider{}
 // MaxPoolSize redis_cluster max pool size
 var MaxPoolSize = 1000
 
-// SessionStore redis_cluster session store
-type SessionStore struct {
-	p           *rediss.ClusterClient
-	sid         string
-	lock        sync.RWMutex
-	values      map[interface{}]interface{}
-	maxlifetime int64
-}
-
-// Set value in redis_cluster session
-func (rs *SessionStore) Set(ctx context.Context, key, value interface{}) error {
-	rs.lock.Lock()
-	defer rs.lock.Unlock()
-	rs.values[key] = value
-	return nil
-}
-
-// Get value in redis_cluster session
-func (rs *SessionStore) Get(ctx context.Context, key interface{}) interface{} {
-	rs.lock.RLock()
-	defer rs.lock.RUnlock()
-	if v, ok := rs.values[key]; ok {
-		return v
-	}
-	return nil
-}
-
-// Delete value in redis_cluster session
-func (rs *SessionStore) Delete(ctx context.Context, key interface{}) error {
-	rs.lock.Lock()
-	defer rs.lock.Unlock()
-	delete(rs.values, key)
-	return nil
-}
-
-// Flush clear all values in redis_cluster session
-func (rs *SessionStore) Flush(context.Context) error {
-	rs.lock.Lock()
-	defer rs.lock.Unlock()
-	rs.values = make(map[interface{}]interface{})
-	return nil
-}
-
-// SessionID get redis_cluster session id
-func (rs *SessionStore) SessionID(context.Context) string {
-	return rs.sid
-}
+const (
+	// LayoutString stores a session as one serialized string, the default
+	LayoutString = redisstore.LayoutString
+	// LayoutHash stores every key of a session as a field of a hash and
+	// only writes the keys a request changed. Concurrent requests for the
+	// same session then only overwrite each other's changes of the same key.
+	LayoutHash = redisstore.LayoutHash
+)
 
-// SessionRelease save session values to redis_cluster
-func (rs *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
-	b, err := session.EncodeGob(rs.values)
-	if err != nil {
-		return
-	}
-	c := rs.p
-	c.Set(rs.sid, string(b), time.Duration(rs.maxlifetime)*time.Second)
-}
+// SessionStore redis_cluster session store
+type SessionStore = redisstore.SessionStore
 
 // Provider redis_cluster session provider
 type Provider struct {
+	redisstore.Provider
+
 	maxlifetime int64
 	SavePath    string `json:"save_path"`
 	Poolsize    int    `json:"poolsize"`
@@ -126,6 +82,7 @@ type Provider struct {
 	idleCheckFrequency    time.Duration
 	IdleCheckFrequencyStr string `json:"idle_check_frequency"`
 	MaxRetries            int    `json:"max_retries"`
+	Layout                string `json:"layout"`
 	poollist              *rediss.ClusterClient
 }
 
@@ -155,6 +112,10 @@ func (rp *Provider) SessionInit(ctx context.Context, maxlifetime int64, cfgStr s
 		rp.initOldStyle(cfgStr)
 	}
 
+	if !redisstore.ValidLayout(rp.Layout) {
+		return errors.New("redis_cluster: unknown layout " + rp.Layout)
+	}
+
 	rp.poollist = rediss.NewClusterClient(&rediss.ClusterOptions{
 		Addrs:              strings.Split(rp.SavePath, ";"),
 		Password:           rp.Password,
@@ -163,7 +124,7 @@ func (rp *Provider) SessionInit(ctx context.Context, maxlifetime int64, cfgStr s
 		IdleCheckFrequency: rp.idleCheckFrequency,
 		MaxRetries:         rp.MaxRetries,
 	})
-	return rp.poollist.Ping().Err()
+	return rp.Init(ctx, rp.poollist, maxlifetime, rp.Layout)
 }
 
 // for v1.x
@@ -215,66 +176,6 @@ func (rp *Provider) initOldStyle(savePath string) {
 	}
 }
 
-// SessionRead read redis_cluster session by sid
-func (rp *Provider) SessionRead(ctx context.Context, sid string) (session.Store, error) {
-	var kv map[interface{}]interface{}
-	kvs, err := rp.poollist.Get(sid).Result()
-	if err != nil && err != rediss.Nil {
-		return nil, err
-	}
-	if len(kvs) == 0 {
-		kv = make(map[interface{}]interface{})
-	} else {
-		if kv, err = session.DecodeGob([]byte(kvs)); err != nil {
-			return nil, err
-		}
-	}
-
-	rs := &SessionStore{p: rp.poollist, sid: sid, values: kv, maxlifetime: rp.maxlifetime}
-	return rs, nil
-}
-
-// SessionExist check redis_cluster session exist by sid
-func (rp *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
-	c := rp.poollist
-	if existed, err := c.Exists(sid).Result(); err != nil || existed == 0 {
-		return false, err
-	}
-	return true, nil
-}
-
-// SessionRegenerate generate new sid for redis_cluster session
-func (rp *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (session.Store, error) {
-	c := rp.poollist
-
-	if existed, err := c.Exists(oldsid).Result(); err != nil || existed == 0 {
-		// oldsid doesn't exists, set the new sid directly
-		// ignore error here, since if it return error
-		// the existed value will be 0
-		c.Set(sid, "", time.Duration(rp.maxlifetime)*time.Second)
-	} else {
-		c.Rename(oldsid, sid)
-		c.Expire(sid, time.Duration(rp.maxlifetime)*time.Second)
-	}
-	return rp.SessionRead(context.Background(), sid)
-}
-
-// SessionDestroy delete redis session by id
-func (rp *Provider) SessionDestroy(ctx context.Context, sid string) error {
-	c := rp.poollist
-	c.Del(sid)
-	return nil
-}
-
-// SessionGC Impelment method, no used.
-func (rp *Provider) SessionGC(context.Context) {
-}
-
-// SessionAll return all activeSession
-func (rp *Provider) SessionAll(context.Context) int {
-	return 0
-}
-
 func init() {
 	session.Register("redis_cluster", redispder)
 }
@@ -48,7 +48,9 @@ func TestRedisSentinel(t *testing.T) {
 		return
 	}
 	// todo test if e==nil
-	go globalSessions.GC()
+	gcCtx, stopGC := context.WithCancel(context.Background())
+	defer stopGC()
+	go globalSessions.GCContext(gcCtx)
 
 	r, _ := http.NewRequest("GET", "/", nil)
 	w := httptest.NewRecorder()
@@ -57,14 +59,14 @@ func TestRedisSentinel(t *testing.T) {
 	if err != nil {
 		t.Fatal("session start failed:", err)
 	}
-	defer sess.SessionRelease(nil, w)
+	defer sess.SessionRelease(r.Context(), w)
 
 	// SET AND GET
 	err = sess.Set(nil, "username", "bhojpur")
 	if err != nil {
 		t.Fatal("set username failed:", err)
 	}
-	username := sess.Get(nil, "username")
+	username, _ := sess.Get(nil, "username")
 	if username != "bhojpur" {
 		t.Fatal("get username failed")
 	}
@@ -74,7 +76,7 @@ func TestRedisSentinel(t *testing.T) {
 	if err != nil {
 		t.Fatal("delete username failed:", err)
 	}
-	username = sess.Get(nil, "username")
+	username, _ = sess.Get(nil, "username")
 	if username != nil {
 		t.Fatal("delete username failed")
 	}
@@ -88,11 +90,11 @@ func TestRedisSentinel(t *testing.T) {
 	if err != nil {
 		t.Fatal("set failed:", err)
 	}
-	username = sess.Get(nil, "username")
+	username, _ = sess.Get(nil, "username")
 	if username != "bhojpur" {
 		t.Fatal("get username failed")
 	}
-	password := sess.Get(nil, "password")
+	password, _ := sess.Get(nil, "password")
 	if password != "1qaz2wsx" {
 		t.Fatal("get password failed")
 	}
@@ -100,16 +102,16 @@ func TestRedisSentinel(t *testing.T) {
 	if err != nil {
 		t.Fatal("flush failed:", err)
 	}
-	username = sess.Get(nil, "username")
+	username, _ = sess.Get(nil, "username")
 	if username != nil {
 		t.Fatal("flush failed")
 	}
-	password = sess.Get(nil, "password")
+	password, _ = sess.Get(nil, "password")
 	if password != nil {
 		t.Fatal("flush failed")
 	}
 
-	sess.SessionRelease(nil, w)
+	sess.SessionRelease(r.Context(), w)
 
 }
 
@@ -38,6 +38,9 @@ var ssdbProvider = &Provider{}
 
 // Provider holds ssdb client and configs
 type Provider struct {
+	session.ProviderSerializer
+
+	mu          sync.Mutex // serializes the use of client
 	client      *ssdb.Client
 	Host        string `json:"host"`
 	Port        int    `json:"port"`
@@ -53,10 +56,28 @@ func (p *Provider) connectInit() error {
 	return err
 }
 
+// do runs fn with the client unless ctx is done first. The client is a single
+// connection, so calls are serialized, also with calls which are still
+// running after their context was done.
+func (p *Provider) do(ctx context.Context, fn func(c *ssdb.Client) error) error {
+	return session.RunWithContext(ctx, func() error {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.client == nil {
+			if err := p.connectInit(); err != nil {
+				return err
+			}
+		}
+		return fn(p.client)
+	})
+}
+
 // SessionInit init the ssdb with the config
 func (p *Provider) SessionInit(ctx context.Context, maxLifetime int64, cfg string) error {
 	p.maxLifetime = maxLifetime
 
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	cfg = strings.TrimSpace(cfg)
 	var err error
 	// we think this is v2.0, using json to init the session
@@ -83,38 +104,28 @@ func (p *Provider) initOldStyle(savePath string) error {
 
 // SessionRead return a ssdb client session Store
 func (p *Provider) SessionRead(ctx context.Context, sid string) (session.Store, error) {
-	if p.client == nil {
-		if err := p.connectInit(); err != nil {
-			return nil, err
-		}
-	}
 	var kv map[interface{}]interface{}
-	value, err := p.client.Get(sid)
+	value, err := p.get(ctx, sid)
 	if err != nil {
 		return nil, err
 	}
 	if value == nil || len(value.(string)) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob([]byte(value.(string)))
+		kv, err = p.Serializer().Deserialize([]byte(value.(string)))
 		if err != nil {
 			return nil, err
 		}
 	}
-	rs := &SessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, client: p.client}
+	rs := &SessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, p: p, serializer: p.Serializer()}
 	return rs, nil
 }
 
 // SessionExist judged whether sid is exist in session
 func (p *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
-	if p.client == nil {
-		if err := p.connectInit(); err != nil {
-			return false, err
-		}
-	}
-	value, err := p.client.Get(sid)
+	value, err := p.get(ctx, sid)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	if value == nil || len(value.(string)) == 0 {
 		return false, nil
@@ -124,13 +135,7 @@ func (p *Provider) SessionExist(ctx context.Context, sid string) (bool, error) {
 
 // SessionRegenerate regenerate session with new sid and delete oldsid
 func (p *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (session.Store, error) {
-	// conn.Do("setx", key, v, ttl)
-	if p.client == nil {
-		if err := p.connectInit(); err != nil {
-			return nil, err
-		}
-	}
-	value, err := p.client.Get(oldsid)
+	value, err := p.get(ctx, oldsid)
 	if err != nil {
 		return nil, err
 	}
@@ -138,32 +143,48 @@ func (p *Provider) SessionRegenerate(ctx context.Context, oldsid, sid string) (s
 	if value == nil || len(value.(string)) == 0 {
 		kv = make(map[interface{}]interface{})
 	} else {
-		kv, err = session.DecodeGob([]byte(value.(string)))
+		kv, err = p.Serializer().Deserialize([]byte(value.(string)))
 		if err != nil {
 			return nil, err
 		}
-		_, err = p.client.Del(oldsid)
+		err = p.do(ctx, func(c *ssdb.Client) error {
+			_, err := c.Del(oldsid)
+			return err
+		})
 		if err != nil {
 			return nil, err
 		}
 	}
-	_, e := p.client.Do("setx", sid, value, p.maxLifetime)
-	if e != nil {
-		return nil, e
+	err = p.do(ctx, func(c *ssdb.Client) error {
+		_, err := c.Do("setx", sid, value, p.maxLifetime)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	rs := &SessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, client: p.client}
+	rs := &SessionStore{sid: sid, values: kv, maxLifetime: p.maxLifetime, p: p, serializer: p.Serializer()}
 	return rs, nil
 }
 
 // SessionDestroy destroy the sid
 func (p *Provider) SessionDestroy(ctx context.Context, sid string) error {
-	if p.client == nil {
-		if err := p.connectInit(); err != nil {
-			return err
-		}
+	return p.do(ctx, func(c *ssdb.Client) error {
+		_, err := c.Del(sid)
+		return err
+	})
+}
+
+// get reads the value of key unless ctx is done first
+func (p *Provider) get(ctx context.Context, key string) (interface{}, error) {
+	var value interface{}
+	err := p.do(ctx, func(c *ssdb.Client) (err error) {
+		value, err = c.Get(key)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-	_, err := p.client.Del(sid)
-	return err
+	return value, nil
 }
 
 // SessionGC not implemented
@@ -181,7 +202,8 @@ type SessionStore struct {
 	lock        sync.RWMutex
 	values      map[interface{}]interface{}
 	maxLifetime int64
-	client      *ssdb.Client
+	p           *Provider
+	serializer  session.Serializer
 }
 
 // Set the key and value
@@ -193,13 +215,24 @@ func (s *SessionStore) Set(ctx context.Context, key, value interface{}) error {
 }
 
 // Get return the value by the key
-func (s *SessionStore) Get(ctx context.Context, key interface{}) interface{} {
+func (s *SessionStore) Get(ctx context.Context, key interface{}) (interface{}, error) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 	if value, ok := s.values[key]; ok {
-		return value
+		return value, nil
 	}
-	return nil
+	return nil, nil
+}
+
+// Values return all keys and values in session store
+func (s *SessionStore) Values(ctx context.Context) map[interface{}]interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	values := make(map[interface{}]interface{}, len(s.values))
+	for k, v := range s.values {
+		values[k] = v
+	}
+	return values
 }
 
 // Delete the key in session store
@@ -224,12 +257,15 @@ func (s *SessionStore) SessionID(context.Context) string {
 }
 
 // SessionRelease Store the keyvalues into ssdb
-func (s *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) {
-	b, err := session.EncodeGob(s.values)
+func (s *SessionStore) SessionRelease(ctx context.Context, w http.ResponseWriter) error {
+	b, err := s.serializer.Serialize(s.values)
 	if err != nil {
-		return
+		return err
 	}
-	s.client.Do("setx", s.sid, string(b), s.maxLifetime)
+	return s.p.do(ctx, func(c *ssdb.Client) error {
+		_, err := c.Do("setx", s.sid, string(b), session.ValuesLifetime(s.values, s.maxLifetime))
+		return err
+	})
 }
 
 func init() {
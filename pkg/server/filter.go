@@ -0,0 +1,133 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strconv"
+	"strings"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+)
+
+// MatchesFilter returns true if the engine matches all filter expressions.
+// An expression matches if any of its terms match.
+//
+// Supported fields are name, phase, owner, spec, success and
+// annotation.<key>. Phases are compared without their PHASE_ prefix and in
+// lower case, e.g. "running".
+func MatchesFilter(status *v1.EngineStatus, filter []*v1.FilterExpression) bool {
+	for _, expr := range filter {
+		if len(expr.Terms) == 0 {
+			continue
+		}
+
+		var matches bool
+		for _, term := range expr.Terms {
+			if matchesTerm(status, term) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesTerm(status *v1.EngineStatus, term *v1.FilterTerm) bool {
+	val, ok := engineField(status, term.Field)
+
+	var res bool
+	switch term.Operation {
+	case v1.FilterOp_OP_EXISTS:
+		res = ok
+	case v1.FilterOp_OP_EQUALS:
+		res = ok && val == term.Value
+	case v1.FilterOp_OP_STARTS_WITH:
+		res = ok && strings.HasPrefix(val, term.Value)
+	case v1.FilterOp_OP_ENDS_WITH:
+		res = ok && strings.HasSuffix(val, term.Value)
+	case v1.FilterOp_OP_CONTAINS:
+		res = ok && strings.Contains(val, term.Value)
+	}
+	if term.Negate {
+		res = !res
+	}
+	return res
+}
+
+// engineField returns the value of a filter/order field of an engine and
+// whether that field is set at all.
+func engineField(status *v1.EngineStatus, field string) (string, bool) {
+	md := status.GetMetadata()
+	switch field {
+	case "name":
+		return status.Name, true
+	case "phase":
+		return PhaseName(status.Phase), true
+	case "owner":
+		return md.GetOwner(), md.GetOwner() != ""
+	case "spec":
+		return md.GetEngineSpecName(), md.GetEngineSpecName() != ""
+	case "success":
+		return strconv.FormatBool(status.GetConditions().GetSuccess()), true
+	case "created":
+		if md.GetCreated() == nil {
+			return "", false
+		}
+		return md.GetCreated().AsTime().UTC().Format("2006-01-02T15:04:05.000000000Z"), true
+	}
+
+	if key := strings.TrimPrefix(field, "annotation."); key != field {
+		for _, a := range md.GetAnnotations() {
+			if a.Key == key {
+				return a.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// PhaseName returns the lower case name of a phase without its prefix
+func PhaseName(phase v1.EnginePhase) string {
+	return strings.ToLower(strings.TrimPrefix(phase.String(), "PHASE_"))
+}
+
+// lessEngine orders engines by the order expressions. Without any order
+// the most recently created engine comes first.
+func lessEngine(a, b *v1.EngineStatus, order []*v1.OrderExpression) bool {
+	if len(order) == 0 {
+		order = []*v1.OrderExpression{{Field: "created", Ascending: false}}
+	}
+	for _, o := range order {
+		va, _ := engineField(a, o.Field)
+		vb, _ := engineField(b, o.Field)
+		if va == vb {
+			continue
+		}
+		if o.Ascending {
+			return va < vb
+		}
+		return va > vb
+	}
+	return false
+}
@@ -0,0 +1,450 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sigs.k8s.io/yaml"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+var (
+	// ErrNotFound is returned when an engine does not exist in the registry
+	ErrNotFound = errors.New("engine not found")
+	// ErrNotReplayable is returned when an engine cannot be started again
+	ErrNotReplayable = errors.New("engine cannot be replayed")
+	// ErrNotRunning is returned when an engine has no session manager (yet)
+	ErrNotRunning = errors.New("engine is not running")
+)
+
+// EngineSpec describes a session engine, i.e. the provider backing it and
+// the configuration of its session manager. It is read from the engine YAML
+// sent with a StartEngineRequest, e.g.
+//
+//	provider: redis
+//	config:
+//	  cookieName: bsessionid
+//	  gclifetime: 3600
+//	  providerConfig: 127.0.0.1:6379
+type EngineSpec struct {
+	Provider string                `json:"provider"`
+	Config   session.ManagerConfig `json:"config"`
+}
+
+// ParseEngineSpec parses an engine YAML (or JSON) document
+func ParseEngineSpec(data []byte) (*EngineSpec, error) {
+	var spec EngineSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, err
+	}
+	if spec.Provider == "" {
+		return nil, errors.New("engine spec has no provider")
+	}
+	if _, err := session.GetProvider(spec.Provider); err != nil {
+		return nil, err
+	}
+	return &spec, nil
+}
+
+// Event is a change to an engine published by the registry. Exactly one of
+// Update and Slice is set.
+type Event struct {
+	Name   string
+	Update *v1.EngineStatus
+	Slice  *v1.LogSliceEvent
+}
+
+// Registry keeps track of the session engines running in this process.
+// Each engine owns a session Manager which is garbage collected
+// periodically until the engine is stopped.
+//
+// Providers are registered globally, hence engines using the same provider
+// share the provider's state.
+type Registry struct {
+	mu      sync.RWMutex
+	engines map[string]*runningEngine
+	counter int
+	subs    map[chan *Event]struct{}
+}
+
+type runningEngine struct {
+	status  *v1.EngineStatus
+	spec    *EngineSpec
+	raw     []byte
+	manager *session.Manager
+	logs    []*v1.LogSliceEvent
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// maxLogSlices is the number of log slices kept per engine for late listeners
+const maxLogSlices = 1000
+
+// NewRegistry creates an empty engine registry
+func NewRegistry() *Registry {
+	return &Registry{
+		engines: make(map[string]*runningEngine),
+		subs:    make(map[chan *Event]struct{}),
+	}
+}
+
+// Start starts a new engine from its YAML specification. The engine keeps
+// waiting until waitUntil (if set) before its session manager is created.
+func (r *Registry) Start(md *v1.EngineMetadata, engineYAML []byte, nameSuffix string, waitUntil time.Time) (*v1.EngineStatus, error) {
+	spec, err := ParseEngineSpec(engineYAML)
+	if err != nil {
+		return nil, err
+	}
+	if md == nil {
+		md = &v1.EngineMetadata{}
+	} else {
+		md = proto.Clone(md).(*v1.EngineMetadata)
+	}
+	md.Created = timestamppb.Now()
+	md.Finished = nil
+
+	base := md.EngineSpecName
+	if base == "" {
+		base = spec.Provider
+	}
+
+	r.mu.Lock()
+	r.counter++
+	name := base + "." + strconv.Itoa(r.counter)
+	if nameSuffix != "" {
+		name += "." + nameSuffix
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &runningEngine{
+		status: &v1.EngineStatus{
+			Name:       name,
+			Metadata:   md,
+			Phase:      v1.EnginePhase_PHASE_PREPARING,
+			Conditions: &v1.EngineConditions{},
+		},
+		spec:   spec,
+		raw:    engineYAML,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	if !waitUntil.IsZero() && waitUntil.After(time.Now()) {
+		e.status.Phase = v1.EnginePhase_PHASE_WAITING
+		e.status.Conditions.WaitUntil = timestamppb.New(waitUntil)
+	}
+	r.engines[name] = e
+	res := proto.Clone(e.status).(*v1.EngineStatus)
+	r.publish(&Event{Name: name, Update: res})
+	r.mu.Unlock()
+
+	go r.run(ctx, e, waitUntil)
+
+	return res, nil
+}
+
+// Replay starts a new engine using the specification of a previous one
+func (r *Registry) Replay(previous string, waitUntil time.Time) (*v1.EngineStatus, error) {
+	r.mu.RLock()
+	e, ok := r.engines[previous]
+	if !ok {
+		r.mu.RUnlock()
+		return nil, ErrNotFound
+	}
+	if !e.status.Conditions.CanReplay {
+		r.mu.RUnlock()
+		return nil, ErrNotReplayable
+	}
+	md := proto.Clone(e.status.Metadata).(*v1.EngineMetadata)
+	raw := e.raw
+	r.mu.RUnlock()
+
+	return r.Start(md, raw, "", waitUntil)
+}
+
+func (r *Registry) run(ctx context.Context, e *runningEngine, waitUntil time.Time) {
+	defer close(e.done)
+	name := e.status.Name
+
+	if d := time.Until(waitUntil); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			r.finish(e, nil)
+			return
+		}
+	}
+
+	r.setPhase(e, v1.EnginePhase_PHASE_STARTING, "creating session manager")
+	mgr, err := newManager(e.spec)
+	if err != nil {
+		log.WithError(err).WithField("name", name).Warn("cannot start engine")
+		r.finish(e, err)
+		return
+	}
+
+	r.mu.Lock()
+	e.manager = mgr
+	e.status.Conditions.DidExecute = true
+	r.mu.Unlock()
+	r.setPhase(e, v1.EnginePhase_PHASE_RUNNING, "session manager is running")
+
+	interval := time.Duration(e.spec.Config.Gclifetime) * time.Second
+	if interval <= 0 {
+		<-ctx.Done()
+		r.finish(e, nil)
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			r.slice(e, &v1.LogSliceEvent{Name: "gc", Type: v1.LogSliceType_SLICE_START})
+			mgr.GetProvider().SessionGC(ctx)
+			r.slice(e, &v1.LogSliceEvent{
+				Name:    "gc",
+				Type:    v1.LogSliceType_SLICE_CONTENT,
+				Payload: fmt.Sprintf("%d active sessions", mgr.GetActiveSession()),
+			})
+			r.slice(e, &v1.LogSliceEvent{Name: "gc", Type: v1.LogSliceType_SLICE_DONE})
+		case <-ctx.Done():
+			r.finish(e, nil)
+			return
+		}
+	}
+}
+
+// newManager creates the session manager of an engine. NewManager panics on
+// some configuration errors which must not take the whole server down.
+func newManager(spec *EngineSpec) (mgr *session.Manager, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("%v", rec)
+		}
+	}()
+	cfg := spec.Config
+	return session.NewManager(spec.Provider, &cfg)
+}
+
+func (r *Registry) setPhase(e *runningEngine, phase v1.EnginePhase, details string) {
+	r.mu.Lock()
+	e.status.Phase = phase
+	e.status.Details = details
+	r.publish(&Event{Name: e.status.Name, Update: proto.Clone(e.status).(*v1.EngineStatus)})
+	r.mu.Unlock()
+
+	r.slice(e, &v1.LogSliceEvent{
+		Name:    phase.String(),
+		Type:    v1.LogSliceType_SLICE_PHASE,
+		Payload: details,
+	})
+}
+
+func (r *Registry) finish(e *runningEngine, err error) {
+	r.setPhase(e, v1.EnginePhase_PHASE_CLEANUP, "stopping session manager")
+
+	r.mu.Lock()
+	e.manager = nil
+	e.status.Phase = v1.EnginePhase_PHASE_DONE
+	e.status.Metadata.Finished = timestamppb.Now()
+	e.status.Conditions.CanReplay = true
+	if err != nil {
+		e.status.Conditions.Success = false
+		e.status.Conditions.FailureCount++
+		e.status.Details = err.Error()
+	} else {
+		e.status.Conditions.Success = true
+		e.status.Details = "engine stopped"
+	}
+	if err != nil {
+		r.appendSlice(e, &v1.LogSliceEvent{Name: "engine", Type: v1.LogSliceType_SLICE_FAIL, Payload: err.Error()})
+	}
+	r.publish(&Event{Name: e.status.Name, Update: proto.Clone(e.status).(*v1.EngineStatus)})
+	r.mu.Unlock()
+}
+
+func (r *Registry) slice(e *runningEngine, s *v1.LogSliceEvent) {
+	r.mu.Lock()
+	r.appendSlice(e, s)
+	r.mu.Unlock()
+}
+
+// appendSlice adds a log slice to an engine and publishes it. r.mu must be held.
+func (r *Registry) appendSlice(e *runningEngine, s *v1.LogSliceEvent) {
+	e.logs = append(e.logs, s)
+	if len(e.logs) > maxLogSlices {
+		e.logs = e.logs[len(e.logs)-maxLogSlices:]
+	}
+	r.publish(&Event{Name: e.status.Name, Slice: s})
+}
+
+// Stop stops a running engine and waits for it to finish
+func (r *Registry) Stop(name string) error {
+	r.mu.RLock()
+	e, ok := r.engines[name]
+	r.mu.RUnlock()
+	if !ok {
+		return ErrNotFound
+	}
+
+	e.cancel()
+	<-e.done
+	return nil
+}
+
+// Close stops all engines in the registry
+func (r *Registry) Close() {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.engines))
+	for name := range r.engines {
+		names = append(names, name)
+	}
+	r.mu.RUnlock()
+
+	for _, name := range names {
+		_ = r.Stop(name)
+	}
+}
+
+// Get returns the status of an engine
+func (r *Registry) Get(name string) (*v1.EngineStatus, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.engines[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return proto.Clone(e.status).(*v1.EngineStatus), nil
+}
+
+// Manager returns the session manager of a running engine
+func (r *Registry) Manager(name string) (*session.Manager, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.engines[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if e.manager == nil {
+		return nil, ErrNotRunning
+	}
+	return e.manager, nil
+}
+
+// Logs returns the log slices an engine has produced so far
+func (r *Registry) Logs(name string) ([]*v1.LogSliceEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	e, ok := r.engines[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	res := make([]*v1.LogSliceEvent, len(e.logs))
+	copy(res, e.logs)
+	return res, nil
+}
+
+// Find returns all engines matching the filter, sorted according to order.
+// It returns the total number of matches next to the requested page.
+func (r *Registry) Find(filter []*v1.FilterExpression, order []*v1.OrderExpression, start, limit int) (total int, res []*v1.EngineStatus) {
+	r.mu.RLock()
+	for _, e := range r.engines {
+		if !MatchesFilter(e.status, filter) {
+			continue
+		}
+		res = append(res, proto.Clone(e.status).(*v1.EngineStatus))
+	}
+	r.mu.RUnlock()
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return lessEngine(res[i], res[j], order)
+	})
+
+	total = len(res)
+	if start > len(res) {
+		start = len(res)
+	}
+	res = res[start:]
+	if limit > 0 && limit < len(res) {
+		res = res[:limit]
+	}
+	return total, res
+}
+
+// Subscribe registers a listener for engine events. The returned function
+// must be called to unsubscribe.
+func (r *Registry) Subscribe() (<-chan *Event, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.subscribe()
+}
+
+// Watch returns the status and the log slices of an engine together with a
+// subscription to its later events, so that listeners neither miss events
+// nor see them twice. The returned function must be called to unsubscribe.
+func (r *Registry) Watch(name string) (*v1.EngineStatus, []*v1.LogSliceEvent, <-chan *Event, func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, ok := r.engines[name]
+	if !ok {
+		return nil, nil, nil, nil, ErrNotFound
+	}
+	logs := make([]*v1.LogSliceEvent, len(e.logs))
+	copy(logs, e.logs)
+	evts, unsubscribe := r.subscribe()
+	return proto.Clone(e.status).(*v1.EngineStatus), logs, evts, unsubscribe, nil
+}
+
+// subscribe registers a listener. r.mu must be held.
+func (r *Registry) subscribe() (<-chan *Event, func()) {
+	ch := make(chan *Event, 100)
+	r.subs[ch] = struct{}{}
+	return ch, func() {
+		r.mu.Lock()
+		delete(r.subs, ch)
+		r.mu.Unlock()
+	}
+}
+
+// publish sends evt to all listeners. r.mu must be held, so that events are
+// published in the order of the changes they describe.
+func (r *Registry) publish(evt *Event) {
+	for ch := range r.subs {
+		select {
+		case ch <- evt:
+		default:
+			log.WithField("name", evt.Name).Warn("engine event listener too slow, dropping event")
+		}
+	}
+}
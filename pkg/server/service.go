@@ -0,0 +1,207 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"html"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+)
+
+// Service implements the SessionService on top of an engine registry
+type Service struct {
+	Engines *Registry
+
+	v1.UnimplementedSessionServiceServer
+}
+
+// NewService creates a new SessionService backed by the registry
+func NewService(engines *Registry) *Service {
+	return &Service{Engines: engines}
+}
+
+// StartEngine starts a new engine from its YAML specification
+func (srv *Service) StartEngine(ctx context.Context, req *v1.StartEngineRequest) (*v1.StartEngineResponse, error) {
+	if len(req.EngineYaml) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "engine_yaml is required")
+	}
+
+	var waitUntil time.Time
+	if req.WaitUntil != nil {
+		waitUntil = req.WaitUntil.AsTime()
+	}
+	res, err := srv.Engines.Start(req.Metadata, req.EngineYaml, req.NameSuffix, waitUntil)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot start engine: %v", err)
+	}
+	return &v1.StartEngineResponse{Status: res}, nil
+}
+
+// StartFromPreviousEngine starts a new engine using the specification of a previous one
+func (srv *Service) StartFromPreviousEngine(ctx context.Context, req *v1.StartFromPreviousEngineRequest) (*v1.StartEngineResponse, error) {
+	var waitUntil time.Time
+	if req.WaitUntil != nil {
+		waitUntil = req.WaitUntil.AsTime()
+	}
+	res, err := srv.Engines.Replay(req.PreviousEngine, waitUntil)
+	if err != nil {
+		return nil, registryError(err)
+	}
+	return &v1.StartEngineResponse{Status: res}, nil
+}
+
+// ListEngines searches for engines known to this server
+func (srv *Service) ListEngines(ctx context.Context, req *v1.ListEnginesRequest) (*v1.ListEnginesResponse, error) {
+	if req.Start < 0 || req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "start and limit must not be negative")
+	}
+	total, res := srv.Engines.Find(req.Filter, req.Order, int(req.Start), int(req.Limit))
+	return &v1.ListEnginesResponse{
+		Total:  int32(total),
+		Result: res,
+	}, nil
+}
+
+// Subscribe streams updates of all engines matching the filter
+func (srv *Service) Subscribe(req *v1.SubscribeRequest, resp v1.SessionService_SubscribeServer) error {
+	evts, unsubscribe := srv.Engines.Subscribe()
+	defer unsubscribe()
+
+	ctx := resp.Context()
+	for {
+		select {
+		case evt := <-evts:
+			if evt.Update == nil || !MatchesFilter(evt.Update, req.Filter) {
+				continue
+			}
+			err := resp.Send(&v1.SubscribeResponse{Result: evt.Update})
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// GetEngine retrieves details of a single engine
+func (srv *Service) GetEngine(ctx context.Context, req *v1.GetEngineRequest) (*v1.GetEngineResponse, error) {
+	res, err := srv.Engines.Get(req.Name)
+	if err != nil {
+		return nil, registryError(err)
+	}
+	return &v1.GetEngineResponse{Result: res}, nil
+}
+
+// Listen streams status updates and log slices of an engine until it is done
+func (srv *Service) Listen(req *v1.ListenRequest, resp v1.SessionService_ListenServer) error {
+	current, logs, evts, unsubscribe, err := srv.Engines.Watch(req.Name)
+	if err != nil {
+		return registryError(err)
+	}
+	defer unsubscribe()
+
+	if req.Updates {
+		err = resp.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Update{Update: current}})
+		if err != nil {
+			return err
+		}
+	}
+	if req.Logs != v1.ListenRequestLogs_LOGS_DISABLED {
+		for _, s := range logs {
+			err = sendSlice(resp, req.Logs, s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if current.Phase == v1.EnginePhase_PHASE_DONE {
+		return nil
+	}
+
+	ctx := resp.Context()
+	for {
+		select {
+		case evt := <-evts:
+			if evt.Name != req.Name {
+				continue
+			}
+			if evt.Slice != nil && req.Logs != v1.ListenRequestLogs_LOGS_DISABLED {
+				err = sendSlice(resp, req.Logs, evt.Slice)
+			}
+			if evt.Update != nil && req.Updates {
+				err = resp.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Update{Update: evt.Update}})
+			}
+			if err != nil {
+				return err
+			}
+			if evt.Update != nil && evt.Update.Phase == v1.EnginePhase_PHASE_DONE {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// sendSlice sends a log slice in the requested log format. Unsliced logs
+// contain the log content only, HTML logs have their payload escaped.
+func sendSlice(resp v1.SessionService_ListenServer, mode v1.ListenRequestLogs, s *v1.LogSliceEvent) error {
+	switch mode {
+	case v1.ListenRequestLogs_LOGS_UNSLICED:
+		if s.Type != v1.LogSliceType_SLICE_CONTENT {
+			return nil
+		}
+	case v1.ListenRequestLogs_LOGS_HTML:
+		s = &v1.LogSliceEvent{
+			Name:    s.Name,
+			Type:    s.Type,
+			Payload: html.EscapeString(s.Payload),
+		}
+	}
+	return resp.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Slice{Slice: s}})
+}
+
+// StopEngine stops a currently running engine
+func (srv *Service) StopEngine(ctx context.Context, req *v1.StopEngineRequest) (*v1.StopEngineResponse, error) {
+	err := srv.Engines.Stop(req.Name)
+	if err != nil {
+		return nil, registryError(err)
+	}
+	return &v1.StopEngineResponse{}, nil
+}
+
+func registryError(err error) error {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNotReplayable), errors.Is(err, ErrNotRunning):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
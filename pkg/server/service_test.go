@@ -0,0 +1,181 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+)
+
+const memoryEngine = `
+provider: memory
+config:
+  cookieName: bsessionid
+  gclifetime: 3600
+`
+
+func waitForPhase(t *testing.T, srv *Service, name string, phase v1.EnginePhase) *v1.EngineStatus {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		resp, err := srv.GetEngine(context.Background(), &v1.GetEngineRequest{Name: name})
+		if err != nil {
+			t.Fatal("get engine failed:", err)
+		}
+		if resp.Result.Phase == phase {
+			return resp.Result
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("engine %s never reached phase %v", name, phase)
+	return nil
+}
+
+func TestServiceEngineLifecycle(t *testing.T) {
+	srv := NewService(NewRegistry())
+	defer srv.Engines.Close()
+	ctx := context.Background()
+
+	resp, err := srv.StartEngine(ctx, &v1.StartEngineRequest{
+		Metadata:   &v1.EngineMetadata{Owner: "bhojpur", EngineSpecName: "web"},
+		EngineYaml: []byte(memoryEngine),
+	})
+	if err != nil {
+		t.Fatal("start engine failed:", err)
+	}
+	name := resp.Status.Name
+	if name != "web.1" {
+		t.Fatalf("unexpected engine name %q", name)
+	}
+	waitForPhase(t, srv, name, v1.EnginePhase_PHASE_RUNNING)
+
+	if _, err := srv.Engines.Manager(name); err != nil {
+		t.Fatal("running engine has no manager:", err)
+	}
+
+	list, err := srv.ListEngines(ctx, &v1.ListEnginesRequest{
+		Filter: []*v1.FilterExpression{{Terms: []*v1.FilterTerm{
+			{Field: "phase", Value: "running"},
+		}}},
+	})
+	if err != nil {
+		t.Fatal("list engines failed:", err)
+	}
+	if list.Total != 1 || list.Result[0].Name != name {
+		t.Fatalf("unexpected list result %v", list)
+	}
+
+	list, err = srv.ListEngines(ctx, &v1.ListEnginesRequest{
+		Filter: []*v1.FilterExpression{{Terms: []*v1.FilterTerm{
+			{Field: "owner", Value: "bhojpur", Negate: true},
+		}}},
+	})
+	if err != nil {
+		t.Fatal("list engines failed:", err)
+	}
+	if list.Total != 0 {
+		t.Fatalf("negated filter matched %d engines", list.Total)
+	}
+
+	if _, err := srv.StopEngine(ctx, &v1.StopEngineRequest{Name: name}); err != nil {
+		t.Fatal("stop engine failed:", err)
+	}
+	done := waitForPhase(t, srv, name, v1.EnginePhase_PHASE_DONE)
+	if !done.Conditions.Success || !done.Conditions.CanReplay {
+		t.Fatalf("unexpected conditions %v", done.Conditions)
+	}
+
+	replay, err := srv.StartFromPreviousEngine(ctx, &v1.StartFromPreviousEngineRequest{PreviousEngine: name})
+	if err != nil {
+		t.Fatal("replay failed:", err)
+	}
+	if replay.Status.Metadata.Owner != "bhojpur" {
+		t.Fatal("replay lost the engine metadata")
+	}
+}
+
+func TestServiceErrors(t *testing.T) {
+	srv := NewService(NewRegistry())
+	defer srv.Engines.Close()
+	ctx := context.Background()
+
+	_, err := srv.StartEngine(ctx, &v1.StartEngineRequest{EngineYaml: []byte("provider: nonexistent")})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+
+	_, err = srv.GetEngine(ctx, &v1.GetEngineRequest{Name: "nonexistent"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	_, err = srv.StopEngine(ctx, &v1.StopEngineRequest{Name: "nonexistent"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
+
+func TestRegistryWatch(t *testing.T) {
+	reg := NewRegistry()
+	defer reg.Close()
+	st, err := reg.Start(nil, []byte(memoryEngine), "", time.Time{})
+	if err != nil {
+		t.Fatal("start engine failed:", err)
+	}
+	reg.mu.RLock()
+	e := reg.engines[st.Name]
+	reg.mu.RUnlock()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				reg.slice(e, &v1.LogSliceEvent{Name: "test", Type: v1.LogSliceType_SLICE_CONTENT})
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		_, logs, evts, unsubscribe, err := reg.Watch(st.Name)
+		if err != nil {
+			t.Fatal("watch failed:", err)
+		}
+		seen := make(map[*v1.LogSliceEvent]bool, len(logs))
+		for _, s := range logs {
+			seen[s] = true
+		}
+		for j := 0; j < 10; j++ {
+			if evt := <-evts; evt.Slice != nil && seen[evt.Slice] {
+				t.Fatal("log slice of the snapshot was sent again")
+			}
+		}
+		unsubscribe()
+	}
+}
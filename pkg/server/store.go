@@ -0,0 +1,315 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+// StoreService implements the SessionStore service on top of the session
+// managers of the engines in a registry
+type StoreService struct {
+	Engines *Registry
+	// DefaultEngine is used for requests which do not name an engine
+	DefaultEngine string
+	// AcceptSessionIDs lets clients choose the IDs of new sessions, as the
+	// remote provider does. Only trusted clients should reach the service
+	// then, others could fix the session IDs of users.
+	AcceptSessionIDs bool
+
+	v1.UnimplementedSessionStoreServer
+}
+
+// NewStoreService creates a new SessionStore service backed by the registry
+func NewStoreService(engines *Registry, defaultEngine string) *StoreService {
+	return &StoreService{Engines: engines, DefaultEngine: defaultEngine}
+}
+
+// manager returns the session manager of the engine a request is meant for
+func (srv *StoreService) manager(name string) (*session.Manager, error) {
+	if name == "" {
+		name = srv.DefaultEngine
+	}
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "no engine given and no default engine configured")
+	}
+
+	mgr, err := srv.Engines.Manager(name)
+	if err != nil {
+		return nil, registryError(err)
+	}
+	// the cookie provider keeps the session in the HTTP response, there is nothing to serve
+	if _, ok := mgr.GetProvider().(*session.CookieProvider); ok {
+		return nil, status.Errorf(codes.FailedPrecondition, "engine %s uses the cookie provider which cannot be served remotely", name)
+	}
+	return mgr, nil
+}
+
+// errSessionIDRejected is returned for session IDs chosen by clients without
+// AcceptSessionIDs
+var errSessionIDRejected = status.Error(codes.PermissionDenied, "session IDs chosen by clients are not accepted")
+
+// readSession reads an existing session through the manager, so that its
+// lock, expiration policies and revocations apply. Callers must release the
+// session.
+func readSession(ctx context.Context, mgr *session.Manager, sid string) (session.Store, error) {
+	if sid == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	store, err := mgr.ReadSession(ctx, sid)
+	if err == session.ErrSessionNotExist {
+		return nil, status.Errorf(codes.NotFound, "session %s does not exist", sid)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return store, nil
+}
+
+// CreateSession creates a new session, optionally with initial values
+func (srv *StoreService) CreateSession(ctx context.Context, req *v1.CreateSessionRequest) (*v1.CreateSessionResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+
+	sid := req.SessionId
+	if sid == "" {
+		sid, err = mgr.NewSessionID()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else if !srv.AcceptSessionIDs {
+		return nil, errSessionIDRejected
+	} else {
+		exists, err := mgr.GetProvider().SessionExist(ctx, sid)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if exists {
+			return nil, status.Errorf(codes.AlreadyExists, "session %s exists already", sid)
+		}
+	}
+
+	store, err := mgr.GetProvider().SessionRead(ctx, sid)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	for k, v := range v1.AsSessionValues(req.Values) {
+		err = store.Set(ctx, k, v)
+		if err != nil {
+			break
+		}
+	}
+	releaseErr := mgr.SessionRelease(ctx, session.NopResponseWriter{}, store)
+	if err == nil {
+		err = releaseErr
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &v1.CreateSessionResponse{SessionId: sid}, nil
+}
+
+// SessionExists checks if a session exists
+func (srv *StoreService) SessionExists(ctx context.Context, req *v1.SessionExistsRequest) (*v1.SessionExistsResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	if req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	exists, err := mgr.GetProvider().SessionExist(ctx, req.SessionId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v1.SessionExistsResponse{Exists: exists}, nil
+}
+
+// GetSession reads the values of a session
+func (srv *StoreService) GetSession(ctx context.Context, req *v1.GetSessionRequest) (*v1.GetSessionResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	store, err := readSession(ctx, mgr, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	defer mgr.SessionRelease(ctx, session.NopResponseWriter{}, store)
+
+	values := make(map[interface{}]interface{})
+	if len(req.Keys) > 0 {
+		for _, k := range req.Keys {
+			v, err := store.Get(ctx, k)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			if v != nil {
+				values[k] = v
+			}
+		}
+	} else if all, ok := store.(session.ValueLister); ok {
+		values = all.Values(ctx)
+	} else {
+		return nil, status.Error(codes.Unimplemented, "the provider cannot list session values, request explicit keys")
+	}
+
+	res, err := v1.NewValues(values)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v1.GetSessionResponse{SessionId: req.SessionId, Values: res}, nil
+}
+
+// SetValues sets values of a session
+func (srv *StoreService) SetValues(ctx context.Context, req *v1.SetValuesRequest) (*v1.SetValuesResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	store, err := readSession(ctx, mgr, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Replace {
+		err = store.Flush(ctx)
+	}
+	if err == nil {
+		for k, v := range v1.AsSessionValues(req.Values) {
+			err = store.Set(ctx, k, v)
+			if err != nil {
+				break
+			}
+		}
+	}
+	releaseErr := mgr.SessionRelease(ctx, session.NopResponseWriter{}, store)
+	if err == nil {
+		err = releaseErr
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v1.SetValuesResponse{}, nil
+}
+
+// DeleteValues removes values from a session
+func (srv *StoreService) DeleteValues(ctx context.Context, req *v1.DeleteValuesRequest) (*v1.DeleteValuesResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	store, err := readSession(ctx, mgr, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range req.Keys {
+		err = store.Delete(ctx, k)
+		if err != nil {
+			break
+		}
+	}
+	releaseErr := mgr.SessionRelease(ctx, session.NopResponseWriter{}, store)
+	if err == nil {
+		err = releaseErr
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v1.DeleteValuesResponse{}, nil
+}
+
+// RegenerateSession moves a session to a new session ID
+func (srv *StoreService) RegenerateSession(ctx context.Context, req *v1.RegenerateSessionRequest) (*v1.RegenerateSessionResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	if req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	sid := req.NewSessionId
+	if sid == "" {
+		sid, err = mgr.NewSessionID()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else if !srv.AcceptSessionIDs {
+		return nil, errSessionIDRejected
+	}
+
+	old, err := readSession(ctx, mgr, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+	// the old session is not released, that would write it again. The
+	// manager unlocks it once it moved.
+	store, err := mgr.SessionRegenerateToID(ctx, req.SessionId, sid)
+	if err != nil {
+		mgr.SessionRelease(ctx, session.NopResponseWriter{}, old)
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	err = mgr.SessionRelease(ctx, session.NopResponseWriter{}, store)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &v1.RegenerateSessionResponse{SessionId: sid}, nil
+}
+
+// DestroySession removes a session
+func (srv *StoreService) DestroySession(ctx context.Context, req *v1.DestroySessionRequest) (*v1.DestroySessionResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	if req.SessionId == "" {
+		return nil, status.Error(codes.InvalidArgument, "session_id is required")
+	}
+
+	err = mgr.SessionDestroyWithID(ctx, req.SessionId)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v1.DestroySessionResponse{}, nil
+}
+
+// CountSessions returns the number of active sessions
+func (srv *StoreService) CountSessions(ctx context.Context, req *v1.CountSessionsRequest) (*v1.CountSessionsResponse, error) {
+	mgr, err := srv.manager(req.Engine)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.CountSessionsResponse{Count: int64(mgr.GetProvider().SessionAll(ctx))}, nil
+}
@@ -0,0 +1,173 @@
+package server
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	v1 "github.com/bhojpur/session/pkg/api/v1"
+	session "github.com/bhojpur/session/pkg/engine"
+)
+
+func TestStoreService(t *testing.T) {
+	engines := NewRegistry()
+	defer engines.Close()
+	ctx := context.Background()
+
+	started, err := engines.Start(nil, []byte(memoryEngine), "", time.Time{})
+	if err != nil {
+		t.Fatal("start engine failed:", err)
+	}
+	waitForPhase(t, NewService(engines), started.Name, v1.EnginePhase_PHASE_RUNNING)
+	srv := NewStoreService(engines, started.Name)
+
+	created, err := srv.CreateSession(ctx, &v1.CreateSessionRequest{
+		Values: map[string]*structpb.Value{"username": structpb.NewStringValue("bhojpur")},
+	})
+	if err != nil {
+		t.Fatal("create session failed:", err)
+	}
+	sid := created.SessionId
+
+	_, err = srv.SetValues(ctx, &v1.SetValuesRequest{
+		SessionId: sid,
+		Values:    map[string]*structpb.Value{"cart": structpb.NewNumberValue(3)},
+	})
+	if err != nil {
+		t.Fatal("set values failed:", err)
+	}
+
+	got, err := srv.GetSession(ctx, &v1.GetSessionRequest{SessionId: sid})
+	if err != nil {
+		t.Fatal("get session failed:", err)
+	}
+	if got.Values["username"].GetStringValue() != "bhojpur" || got.Values["cart"].GetNumberValue() != 3 {
+		t.Fatalf("unexpected values %v", got.Values)
+	}
+
+	_, err = srv.DeleteValues(ctx, &v1.DeleteValuesRequest{SessionId: sid, Keys: []string{"cart"}})
+	if err != nil {
+		t.Fatal("delete values failed:", err)
+	}
+	got, err = srv.GetSession(ctx, &v1.GetSessionRequest{SessionId: sid, Keys: []string{"username", "cart"}})
+	if err != nil {
+		t.Fatal("get session failed:", err)
+	}
+	if _, ok := got.Values["cart"]; ok || len(got.Values) != 1 {
+		t.Fatalf("unexpected values after delete %v", got.Values)
+	}
+
+	regenerated, err := srv.RegenerateSession(ctx, &v1.RegenerateSessionRequest{SessionId: sid})
+	if err != nil {
+		t.Fatal("regenerate session failed:", err)
+	}
+	if regenerated.SessionId == sid {
+		t.Fatal("regenerated session kept its id")
+	}
+	exists, err := srv.SessionExists(ctx, &v1.SessionExistsRequest{SessionId: sid})
+	if err != nil || exists.Exists {
+		t.Fatal("old session id still exists", err)
+	}
+
+	count, err := srv.CountSessions(ctx, &v1.CountSessionsRequest{})
+	if err != nil || count.Count < 1 {
+		t.Fatal("count sessions failed", count, err)
+	}
+
+	_, err = srv.DestroySession(ctx, &v1.DestroySessionRequest{SessionId: regenerated.SessionId})
+	if err != nil {
+		t.Fatal("destroy session failed:", err)
+	}
+	_, err = srv.GetSession(ctx, &v1.GetSessionRequest{SessionId: regenerated.SessionId})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+
+	_, err = srv.CreateSession(ctx, &v1.CreateSessionRequest{SessionId: "chosen"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("expected PermissionDenied, got %v", err)
+	}
+	srv.AcceptSessionIDs = true
+	if _, err = srv.CreateSession(ctx, &v1.CreateSessionRequest{SessionId: "chosen"}); err != nil {
+		t.Fatal("create session with accepted id failed:", err)
+	}
+
+	_, err = srv.CountSessions(ctx, &v1.CountSessionsRequest{Engine: "nonexistent"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
+
+func TestStoreServiceExpiredSession(t *testing.T) {
+	engines := NewRegistry()
+	defer engines.Close()
+	ctx := context.Background()
+
+	started, err := engines.Start(nil, []byte(memoryEngine+"  idleTimeout: 3600\n"), "", time.Time{})
+	if err != nil {
+		t.Fatal("start engine failed:", err)
+	}
+	waitForPhase(t, NewService(engines), started.Name, v1.EnginePhase_PHASE_RUNNING)
+	srv := NewStoreService(engines, started.Name)
+	mgr, err := engines.Manager(started.Name)
+	if err != nil {
+		t.Fatal("engine has no manager:", err)
+	}
+
+	created, err := srv.CreateSession(ctx, &v1.CreateSessionRequest{})
+	if err != nil {
+		t.Fatal("create session failed:", err)
+	}
+	store, _ := mgr.GetProvider().SessionRead(ctx, created.SessionId)
+	if err = mgr.SetSessionUser(ctx, store, "alice"); err != nil {
+		t.Fatal("set user failed:", err)
+	}
+	store.SessionRelease(ctx, session.NopResponseWriter{})
+
+	// regenerating moves the session of the user to the new ID
+	regenerated, err := srv.RegenerateSession(ctx, &v1.RegenerateSessionRequest{SessionId: created.SessionId})
+	if err != nil {
+		t.Fatal("regenerate session failed:", err)
+	}
+	sids, err := mgr.UserSessions(ctx, "alice")
+	if err != nil || len(sids) != 1 || sids[0] != regenerated.SessionId {
+		t.Fatal("unexpected sessions of user", sids, err)
+	}
+
+	// idle for longer than the idle timeout
+	store, _ = mgr.GetProvider().SessionRead(ctx, regenerated.SessionId)
+	store.Set(ctx, session.AccessedKey, time.Now().Add(-2*time.Hour).Unix())
+	store.SessionRelease(ctx, session.NopResponseWriter{})
+	_, err = srv.GetSession(ctx, &v1.GetSessionRequest{SessionId: regenerated.SessionId})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for an expired session, got %v", err)
+	}
+	_, err = srv.RegenerateSession(ctx, &v1.RegenerateSessionRequest{SessionId: regenerated.SessionId})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for a destroyed session, got %v", err)
+	}
+}
@@ -26,6 +26,15 @@ package main
 import (
 	cmd "github.com/bhojpur/session/cmd/server"
 
+	_ "github.com/bhojpur/session/pkg/provider/couchbase"
+	_ "github.com/bhojpur/session/pkg/provider/ledis"
+	_ "github.com/bhojpur/session/pkg/provider/memcache"
+	_ "github.com/bhojpur/session/pkg/provider/mysql"
+	_ "github.com/bhojpur/session/pkg/provider/postgres"
+	_ "github.com/bhojpur/session/pkg/provider/redis"
+	_ "github.com/bhojpur/session/pkg/provider/redis_cluster"
+	_ "github.com/bhojpur/session/pkg/provider/redis_sentinel"
+	_ "github.com/bhojpur/session/pkg/provider/ssdb"
 	_ "github.com/bhojpur/session/pkg/webui"
 	_ "github.com/lib/pq"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"